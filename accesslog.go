@@ -0,0 +1,28 @@
+package dynhttpsrv
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// accessLog logs method, path, status, response size and duration of every request
+// served by next
+func accessLog(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rw.Status()),
+			slog.Int64("size", rw.size),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if id := RequestID(r.Context()); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	})
+}
@@ -0,0 +1,73 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordHandler is a slog.Handler keeping every record it handles
+type recordHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler      { return h }
+
+// attrs returns the attributes of the records with message msg
+func (h *recordHandler) attrs(msg string) []map[string]slog.Value {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var found []map[string]slog.Value
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		found = append(found, attrs)
+	}
+	return found
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := &recordHandler{}
+	dhs := newServer(t, WithAccessLog(slog.New(logs)))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/created"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}})
+	expect(t, dhs, "POST", "/created", http.StatusCreated, "hello")
+	expect(t, dhs, "GET", "/missing", http.StatusNotFound, "")
+	lines := logs.attrs("request")
+	if len(lines) != 2 {
+		t.Fatalf("%d access log lines for 2 requests", len(lines))
+	}
+	line := lines[0]
+	if line["method"].String() != "POST" || line["path"].String() != "/created" ||
+		line["status"].Int64() != http.StatusCreated || line["size"].Int64() != 5 {
+		t.Fatalf("access log line %v", line)
+	}
+	if d := line["duration"].Duration(); d <= 0 || d > time.Second {
+		t.Fatalf("implausible duration %v", d)
+	}
+	if lines[1]["status"].Int64() != http.StatusNotFound {
+		t.Fatalf("404 logged as %v", lines[1]["status"])
+	}
+}
@@ -0,0 +1,63 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestInfo describes a completed request to the hooks registered with UseAfter
+type RequestInfo struct {
+	Method string
+	// Route is the matched route template, such as "/users/{id}", or empty if no
+	// endpoint matched
+	Route    string
+	Status   int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// UseAfter registers fn to run after every request completes, including requests
+// short-circuited by Use middleware and requests whose handler panicked, which are
+// reported with a 500. Unlike middleware it cannot alter the response. If reloading
+// the router fails fn is not kept.
+func (dhs *DynHttpSrv) UseAfter(fn func(*RequestInfo)) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	dhs.afterHooks = append(dhs.afterHooks, fn)
+	dhs.settingsVersion++
+	if err := dhs.reloadEndpoints(); err != nil {
+		dhs.afterHooks = dhs.afterHooks[:len(dhs.afterHooks)-1]
+		return err
+	}
+	return nil
+}
+
+// runAfter calls hooks with the outcome of every request served by next, letting
+// panics go on once they ran
+func runAfter(hooks []func(*RequestInfo), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, state := withRequestState(r)
+		rw := newResponseWriter(w)
+		defer func() {
+			recovered := recover()
+			info := &RequestInfo{
+				Method:   r.Method,
+				Route:    state.route,
+				Status:   rw.Status(),
+				Bytes:    rw.size,
+				Duration: time.Since(start),
+			}
+			if recovered != nil && rw.status == 0 {
+				info.Status = http.StatusInternalServerError
+			}
+			for _, hook := range hooks {
+				hook(info)
+			}
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,62 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestUseAfter(t *testing.T) {
+	dhs := newServer(t, WithRecovery())
+	var mu sync.Mutex
+	var infos []RequestInfo
+	dhs.UseAfter(func(info *RequestInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		infos = append(infos, *info)
+	})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/users/{id}"}, Handler: text("hello")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/panic"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}})
+	expect(t, dhs, "GET", "/users/7", http.StatusOK, "hello")
+	expect(t, dhs, "POST", "/panic", http.StatusInternalServerError, "")
+	expect(t, dhs, "GET", "/missing", http.StatusNotFound, "")
+
+	want := []RequestInfo{
+		{Method: "GET", Route: "/users/{id}", Status: http.StatusOK, Bytes: 5},
+		{Method: "POST", Route: "/panic", Status: http.StatusInternalServerError},
+		{Method: "GET", Route: "", Status: http.StatusNotFound},
+	}
+	if len(infos) != len(want) {
+		t.Fatalf("%d after hook calls, want %d", len(infos), len(want))
+	}
+	for i, got := range infos {
+		if got.Method != want[i].Method || got.Route != want[i].Route || got.Status != want[i].Status {
+			t.Errorf("call %d got %+v, want %+v", i, got, want[i])
+		}
+		if want[i].Bytes != 0 && got.Bytes != want[i].Bytes {
+			t.Errorf("call %d got %d bytes, want %d", i, got.Bytes, want[i].Bytes)
+		}
+		if got.Duration <= 0 {
+			t.Errorf("call %d has no duration", i)
+		}
+	}
+}
+
+func TestUseAfterReportsReloadError(t *testing.T) {
+	fail := false
+	dhs := newServer(t, failingReloads(&fail))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/a"}, Handler: text("a")})
+	calls := 0
+	fail = true
+	if err := dhs.UseAfter(func(*RequestInfo) { calls++ }); err == nil {
+		t.Fatal("UseAfter returned no error")
+	}
+	fail = false
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/b"}, Handler: text("b")})
+	expect(t, dhs, "GET", "/a", http.StatusOK, "a")
+	if calls != 0 || len(dhs.afterHooks) != 0 {
+		t.Fatalf("hook kept after a failed UseAfter, called %d times", calls)
+	}
+}
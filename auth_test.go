@@ -0,0 +1,85 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type claimsKey struct{}
+
+func TestBasicAuth(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{
+		Paths:      []string{"/"},
+		Middleware: []Middleware{WithBasicAuth(BasicAuthCredentials("admin", "secret"))},
+		Handler:    text("welcome"),
+	})
+	tests := []struct {
+		name   string
+		header []string
+		status int
+	}{
+		{"missing", nil, http.StatusUnauthorized},
+		{"wrong password", []string{"Authorization", "Basic YWRtaW46d3Jvbmc="}, http.StatusUnauthorized},
+		{"wrong user", []string{"Authorization", "Basic cm9vdDpzZWNyZXQ="}, http.StatusUnauthorized},
+		{"success", []string{"Authorization", "Basic YWRtaW46c2VjcmV0"}, http.StatusOK},
+	}
+	for _, test := range tests {
+		resp, body := do(t, dhs, "GET", "/", test.header...)
+		if resp.StatusCode != test.status {
+			t.Fatalf("%s: got %d", test.name, resp.StatusCode)
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if test.status == http.StatusUnauthorized && !strings.HasPrefix(challenge, "Basic ") {
+			t.Fatalf("%s: WWW-Authenticate %q", test.name, challenge)
+		}
+		if test.status == http.StatusOK && body != "welcome" {
+			t.Fatalf("%s: body %q", test.name, body)
+		}
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	dhs := newServer(t, WithRequestID())
+	verify := func(token string) (context.Context, bool) {
+		if token != "good" {
+			return nil, false
+		}
+		return context.WithValue(context.Background(), claimsKey{}, "alice"), true
+	}
+	var user, requestID string
+	var cancellable bool
+	dhs.AddEndpoint(&Endpoint{
+		Paths:      []string{"/"},
+		Middleware: []Middleware{WithBearerAuth(verify)},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			user, _ = r.Context().Value(claimsKey{}).(string)
+			requestID = RequestID(r.Context())
+			cancellable = r.Context().Done() != nil
+		},
+	})
+	tests := []struct {
+		name      string
+		header    []string
+		challenge string
+	}{
+		{"missing", nil, `Bearer realm="restricted"`},
+		{"other scheme", []string{"Authorization", "Basic YWRtaW46c2VjcmV0"}, `Bearer realm="restricted"`},
+		{"wrong token", []string{"Authorization", "Bearer bad"}, `Bearer realm="restricted", error="invalid_token"`},
+	}
+	for _, test := range tests {
+		resp, _ := do(t, dhs, "GET", "/", test.header...)
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != test.challenge {
+			t.Fatalf("%s: got %d, WWW-Authenticate %q", test.name, resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+	resp, _ := do(t, dhs, "GET", "/", "Authorization", "bearer good")
+	if resp.StatusCode != http.StatusOK || user != "alice" {
+		t.Fatalf("success: got %d, claims %q", resp.StatusCode, user)
+	}
+	if requestID == "" || !cancellable {
+		t.Fatalf("request context lost: request ID %q, cancellable %v", requestID, cancellable)
+	}
+}
@@ -0,0 +1,64 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// optionsKey identifies the host and path template of routes sharing an Allow list
+type optionsKey struct {
+	host, path string
+}
+
+// registerOptions adds a route answering OPTIONS with 204 and an Allow header for
+// every host and path combination of endpoints, aggregating the methods all of them
+// serve there. Combinations served by an endpoint accepting any method or OPTIONS
+// itself, as well as endpoints without Paths, are left alone.
+func registerOptions(router *mux.Router, endpoints []*Endpoint) {
+	var keys []optionsKey
+	allowed := make(map[optionsKey][]string)
+	skipped := make(map[optionsKey]bool)
+	for _, endpoint := range endpoints {
+		if endpoint.Paths == nil {
+			continue
+		}
+		hosts := endpoint.Hosts
+		if hosts == nil {
+			hosts = []string{""}
+		}
+		methods := endpointMethods(endpoint)
+		for _, host := range hosts {
+			for _, path := range endpointPaths(endpoint) {
+				key := optionsKey{host: host, path: path}
+				if len(methods) == 0 || containsFold(methods, http.MethodOptions) {
+					skipped[key] = true
+					continue
+				}
+				if _, ok := allowed[key]; !ok {
+					keys = append(keys, key)
+				}
+				for _, method := range methods {
+					if !containsFold(allowed[key], method) {
+						allowed[key] = append(allowed[key], strings.ToUpper(method))
+					}
+				}
+			}
+		}
+	}
+	for _, key := range keys {
+		if skipped[key] {
+			continue
+		}
+		allow := strings.Join(append(allowed[key], http.MethodOptions), ", ")
+		route := router.NewRoute()
+		if key.host != "" {
+			route.Host(key.host)
+		}
+		route.Path(key.path).Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package dynhttpsrv
+
+import "net/http"
+
+// limitBody rejects requests declaring a body larger than limit with a 413 and caps
+// the body of the others, so reading beyond limit fails
+func limitBody(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+package dynhttpsrv
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoLength answers with the length of the request body, or 413 once reading it
+// hits the limit
+func echoLength(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	io.WriteString(w, strings.Repeat("x", len(body)))
+}
+
+func TestMaxBodySize(t *testing.T) {
+	dhs := newServer(t, WithMaxBodySize(8))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/small"}, Handler: echoLength})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/upload"}, MaxBodySize: 64, Handler: echoLength})
+	post := func(target string, body string, chunked bool) *http.Response {
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+		}
+		return dhs.ServeRequest(req)
+	}
+	if resp := post("/small", "12345678", false); resp.StatusCode != http.StatusOK {
+		t.Fatalf("under the limit got %d", resp.StatusCode)
+	}
+	if resp := post("/small", "123456789", false); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("declared over the limit got %d", resp.StatusCode)
+	}
+	if resp := post("/small", "123456789", true); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("undeclared over the limit got %d", resp.StatusCode)
+	}
+	if resp := post("/upload", strings.Repeat("u", 64), false); resp.StatusCode != http.StatusOK {
+		t.Fatalf("endpoint limit not applied: %d", resp.StatusCode)
+	}
+}
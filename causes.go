@@ -0,0 +1,56 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrClientClosed is the cause, as reported by context.Cause, of request
+	// contexts cancelled because the client went away
+	ErrClientClosed = errors.New("client closed the request")
+	// ErrServerTimeout is the cause, as reported by context.Cause, of request
+	// contexts cancelled because the endpoint's Timeout elapsed
+	ErrServerTimeout = errors.New("server timeout elapsed")
+)
+
+// clientCause makes the contexts of requests to next report ErrClientClosed as
+// their cause once the connection carrying them is closed. net/http cancels
+// request contexts without a cause, so the context next sees is detached from the
+// original one and cancelled after it instead, keeping causes set on purpose such
+// as ErrDrainTimeout.
+func clientCause(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent := r.Context()
+		ctx, cancel := context.WithCancelCause(context.WithoutCancel(parent))
+		stop := context.AfterFunc(parent, func() {
+			cause := context.Cause(parent)
+			if cause == context.Canceled {
+				cause = ErrClientClosed
+			}
+			cancel(cause)
+		})
+		defer func() {
+			stop()
+			cancel(context.Canceled)
+		}()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// timeoutCause cancels the contexts of requests to next with ErrServerTimeout as
+// their cause once timeout elapsed
+func timeoutCause(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeoutCause(r.Context(), timeout, ErrServerTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientClosed reports whether r was cancelled because its client went away
+func clientClosed(r *http.Request) bool {
+	return errors.Is(context.Cause(r.Context()), ErrClientClosed)
+}
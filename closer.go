@@ -0,0 +1,52 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"io"
+)
+
+// closerOf returns what closes the resources of endpoint: its Closer, or else its
+// HandlerObj if that implements io.Closer
+func closerOf(endpoint *Endpoint) io.Closer {
+	if endpoint.Closer != nil {
+		return endpoint.Closer
+	}
+	if closer, ok := endpoint.HandlerObj.(io.Closer); ok {
+		return closer
+	}
+	return nil
+}
+
+// closeRemoved closes the endpoints of previous, the ones the router was built from
+// before the reload which just succeeded, which are no longer registered. Each is
+// closed in the background once the requests it was serving completed. Callers must
+// hold dhs.mu.
+func (dhs *DynHttpSrv) closeRemoved(previous []*Endpoint) {
+	for _, endpoint := range previous {
+		closer := closerOf(endpoint)
+		if closer == nil || dhs.indexOf(endpoint) != -1 {
+			continue
+		}
+		closed := make(chan struct{})
+		endpoint.closed = closed
+		go dhs.closeEndpoint(endpoint, closer, closed)
+	}
+}
+
+// closeEndpoint calls closer once the requests endpoint is serving completed, unless
+// the endpoint was registered again meanwhile, then closes closed
+func (dhs *DynHttpSrv) closeEndpoint(endpoint *Endpoint, closer io.Closer, closed chan struct{}) {
+	defer close(closed)
+	if endpoint.inflight != nil {
+		endpoint.inflight.wait(context.Background())
+	}
+	dhs.mu.Lock()
+	superseded := endpoint.closed != closed || dhs.indexOf(endpoint) != -1
+	dhs.mu.Unlock()
+	if superseded {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		dhs.logger.Error("Closing removed endpoint failed", "paths", endpoint.Paths, "error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingCloser counts its Close calls, checking finished was set before each
+type countingCloser struct {
+	calls    atomic.Int32
+	early    atomic.Bool
+	finished *atomic.Bool
+}
+
+func (c *countingCloser) Close() error {
+	if c.finished != nil && !c.finished.Load() {
+		c.early.Store(true)
+	}
+	c.calls.Add(1)
+	return nil
+}
+
+// waitClosed fails the test unless the removed endpoint was done closing within d
+func waitClosed(t *testing.T, endpoint *Endpoint, d time.Duration) {
+	t.Helper()
+	select {
+	case <-endpoint.closed:
+	case <-time.After(d):
+		t.Fatalf("endpoint not closed after %v", d)
+	}
+}
+
+func TestCloserRunsAfterDrain(t *testing.T) {
+	dhs := newServer(t)
+	var finished atomic.Bool
+	closer := &countingCloser{finished: &finished}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	endpoint := &Endpoint{Paths: []string{"/plugin"}, Closer: closer, Handler: func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		finished.Store(true)
+	}}
+	dhs.AddEndpoint(endpoint)
+	go dhs.ServeRequest(httptest.NewRequest("GET", "/plugin", nil))
+	<-started
+	if err := dhs.DelEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if closer.calls.Load() != 0 {
+		t.Fatal("endpoint closed while a request was in flight")
+	}
+	close(release)
+	waitClosed(t, endpoint, 5*time.Second)
+	// later reloads leave it alone
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/other"}, Handler: text("other")})
+	if calls := closer.calls.Load(); calls != 1 || closer.early.Load() {
+		t.Fatalf("Close called %d times, before the request finished: %v", calls, closer.early.Load())
+	}
+}
+
+// closingHandler is an http.Handler which is also an io.Closer
+type closingHandler struct {
+	countingCloser
+}
+
+func (*closingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func TestHandlerObjIsClosed(t *testing.T) {
+	dhs := newServer(t)
+	handler := &closingHandler{}
+	endpoint := &Endpoint{Paths: []string{"/plugin"}, HandlerObj: handler}
+	dhs.AddEndpoint(endpoint)
+	dhs.DelEndpoint(endpoint)
+	waitClosed(t, endpoint, 5*time.Second)
+	if calls := handler.calls.Load(); calls != 1 {
+		t.Fatalf("Close called %d times", calls)
+	}
+}
+
+func TestReaddedEndpointIsNotClosed(t *testing.T) {
+	dhs := newServer(t)
+	closer := &countingCloser{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	endpoint := &Endpoint{Paths: []string{"/plugin"}, Closer: closer, Handler: func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}}
+	dhs.AddEndpoint(endpoint)
+	go dhs.ServeRequest(httptest.NewRequest("GET", "/plugin", nil))
+	<-started
+	dhs.DelEndpoint(endpoint)
+	closed := endpoint.closed
+	dhs.AddEndpoint(endpoint)
+	close(release)
+	<-closed
+	if calls := closer.calls.Load(); calls != 0 {
+		t.Fatalf("endpoint registered again was closed %d times", calls)
+	}
+}
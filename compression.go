@@ -0,0 +1,211 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultCompressionThreshold is the minimum response size worth compressing
+const defaultCompressionThreshold = 1024
+
+// incompressibleTypes lists content type prefixes which are already compressed
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/x-bzip2", "application/x-xz", "application/zstd",
+	"application/x-7z-compressed", "application/vnd.rar",
+	"font/woff", "font/woff2",
+}
+
+// compression compresses responses of at least threshold bytes with gzip or deflate,
+// whichever the client accepts
+func compression(level, threshold int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			level:          level,
+			threshold:      threshold,
+		}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header, or ""
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if _, value, ok := strings.Cut(params, "q="); ok {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter buffers the start of a response until it knows whether the response
+// is worth compressing, then either compresses or passes everything through. It
+// preserves http.Flusher and http.Hijacker but not io.ReaderFrom, since every byte
+// has to go through the encoder.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding  string
+	level     int
+	threshold int
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		if cw.decided && cw.encoder == nil {
+			cw.ResponseWriter.WriteHeader(status)
+		}
+		return
+	}
+	if status < http.StatusOK && status != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+	if !bodyAllowed(status) {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.threshold {
+			return len(b), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide sends the header, compressing the response if compress is true and its
+// content type is worth compressing, then writes out anything buffered so far
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if compress && header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		if cw.encoding == "gzip" {
+			cw.encoder, _ = gzip.NewWriterLevel(cw.ResponseWriter, cw.level)
+		} else {
+			cw.encoder, _ = flate.NewWriter(cw.ResponseWriter, cw.level)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush compresses the response regardless of its size, since a streaming handler
+// wants what it wrote so far delivered
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.decide(true)
+	}
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	cw.decided = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the response, sending small responses uncompressed
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return
+		}
+		cw.decide(false)
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
+
+func compressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified && status >= http.StatusOK
+}
@@ -0,0 +1,94 @@
+package dynhttpsrv
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	payload := strings.Repeat(`{"name":"value"},`, 200)
+	dhs := newServer(t, WithCompression(gzip.BestSpeed))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/big"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, payload)
+	}})
+	resp, raw := do(t, dhs, "GET", "/big", "Accept-Encoding", "gzip")
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("headers %v", resp.Header)
+	}
+	if len(raw) >= len(payload) {
+		t.Fatalf("compressed body of %d bytes for %d", len(raw), len(payload))
+	}
+	zr, err := gzip.NewReader(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil || string(body) != payload {
+		t.Fatalf("round trip gave %d bytes, %v", len(body), err)
+	}
+
+	resp, raw = do(t, dhs, "GET", "/big", "Accept-Encoding", "deflate")
+	if resp.Header.Get("Content-Encoding") != "deflate" {
+		t.Fatalf("headers %v", resp.Header)
+	}
+	body, _ = io.ReadAll(flate.NewReader(strings.NewReader(raw)))
+	if string(body) != payload {
+		t.Fatal("deflate round trip failed")
+	}
+}
+
+func TestCompressionSkipsSmallAndCompressed(t *testing.T) {
+	dhs := newServer(t, WithCompression(gzip.DefaultCompression))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/tiny"}, Handler: text("tiny")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/image"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, 4096))
+	}})
+	resp, body := do(t, dhs, "GET", "/tiny", "Accept-Encoding", "gzip")
+	if resp.Header.Get("Content-Encoding") != "" || body != "tiny" {
+		t.Fatalf("tiny response got %q encoded %q", body, resp.Header.Get("Content-Encoding"))
+	}
+	resp, body = do(t, dhs, "GET", "/image", "Accept-Encoding", "gzip")
+	if resp.Header.Get("Content-Encoding") != "" || len(body) != 4096 {
+		t.Fatalf("image response encoded %q", resp.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestCompressionFlushes(t *testing.T) {
+	dhs, url := startServer(t, WithCompression(gzip.DefaultCompression))
+	proceed := make(chan struct{})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/stream"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first")
+		w.(http.Flusher).Flush()
+		<-proceed
+		io.WriteString(w, "second")
+	}})
+	resp, err := http.Get(url + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	first := make([]byte, len("first"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "first" {
+		t.Fatalf("flushed part %q, %v", first, err)
+	}
+	close(proceed)
+	rest, _ := io.ReadAll(resp.Body)
+	if string(rest) != "second" {
+		t.Fatalf("rest %q", rest)
+	}
+}
+
+func TestCompressionRejectsInvalidLevel(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithCompression accepted level 42")
+		}
+	}()
+	WithCompression(42)
+}
@@ -0,0 +1,50 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RouteConfig declares an endpoint as data, for example decoded from JSON, its
+// handler and middleware being referred to by name
+type RouteConfig struct {
+	Methods    []string          `json:"methods,omitempty"`
+	Paths      []string          `json:"paths,omitempty"`
+	Hosts      []string          `json:"hosts,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Queries    map[string]string `json:"queries,omitempty"`
+	Priority   int               `json:"priority,omitempty"`
+	Handler    string            `json:"handler"`
+	Middleware []string          `json:"middleware,omitempty"`
+}
+
+// ApplyConfig replaces all registered endpoints with the ones cfg declares, looking
+// their handlers up in handlers and their middleware up in middleware. If a name is
+// unknown or the endpoints are not valid together, the registered ones are kept.
+func (dhs *DynHttpSrv) ApplyConfig(cfg []RouteConfig, handlers map[string]http.HandlerFunc, middleware map[string]Middleware) error {
+	endpoints := make([]*Endpoint, 0, len(cfg))
+	for i, route := range cfg {
+		handler, ok := handlers[route.Handler]
+		if !ok {
+			return fmt.Errorf("route %d: unknown handler %q", i, route.Handler)
+		}
+		endpoint := &Endpoint{
+			Methods:  route.Methods,
+			Paths:    route.Paths,
+			Hosts:    route.Hosts,
+			Headers:  route.Headers,
+			Queries:  route.Queries,
+			Priority: route.Priority,
+			Handler:  handler,
+		}
+		for _, name := range route.Middleware {
+			mw, ok := middleware[name]
+			if !ok {
+				return fmt.Errorf("route %d: unknown middleware %q", i, name)
+			}
+			endpoint.Middleware = append(endpoint.Middleware, mw)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return dhs.SetEndpoints(endpoints)
+}
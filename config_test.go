@@ -0,0 +1,57 @@
+package dynhttpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestApplyConfig(t *testing.T) {
+	dhs := newServer(t)
+	handlers := map[string]http.HandlerFunc{
+		"users":  text("users"),
+		"orders": text("orders"),
+		"health": text("ok"),
+	}
+	middleware := map[string]Middleware{"tagged": tag("t")}
+	var cfg []RouteConfig
+	err := json.Unmarshal([]byte(`[
+		{"methods": ["GET"], "paths": ["/users"], "handler": "users", "middleware": ["tagged"]},
+		{"paths": ["/orders"], "handler": "orders"}
+	]`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dhs.ApplyConfig(cfg, handlers, middleware); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := do(t, dhs, "GET", "/users")
+	if body != "users" || resp.Header.Get("X-Order") != "t" {
+		t.Fatalf("got %q, X-Order %q", body, resp.Header.Get("X-Order"))
+	}
+	expect(t, dhs, "POST", "/users", http.StatusMethodNotAllowed, "")
+	expect(t, dhs, "GET", "/orders", http.StatusOK, "orders")
+
+	changed := []RouteConfig{
+		{Paths: []string{"/users"}, Handler: "users"},
+		{Paths: []string{"/healthz"}, Handler: "health"},
+	}
+	if err := dhs.ApplyConfig(changed, handlers, middleware); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "POST", "/users", http.StatusOK, "users")
+	expect(t, dhs, "GET", "/orders", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/healthz", http.StatusOK, "ok")
+
+	for _, bad := range [][]RouteConfig{
+		{{Paths: []string{"/new"}, Handler: "missing"}},
+		{{Paths: []string{"/new"}, Handler: "users", Middleware: []string{"missing"}}},
+		{{Paths: []string{"/new/{id"}, Handler: "users"}},
+	} {
+		if err := dhs.ApplyConfig(bad, handlers, middleware); err == nil {
+			t.Fatalf("ApplyConfig(%+v) returned no error", bad)
+		}
+		expect(t, dhs, "GET", "/healthz", http.StatusOK, "ok")
+		expect(t, dhs, "GET", "/new", http.StatusNotFound, "")
+	}
+}
@@ -0,0 +1,117 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// catchAllPath labels the PathPrefix("/") route of endpoints having no Paths
+const catchAllPath = "/*"
+
+// routeConflict returns an error naming the first (method, path) pair of endpoint
+// which one of existing already handles, or nil if there is none. Endpoints with
+// Matchers never conflict, as what their matchers accept cannot be compared.
+func routeConflict(existing []*Endpoint, endpoint *Endpoint) error {
+	if len(endpoint.Matchers) > 0 {
+		return nil
+	}
+	for _, other := range existing {
+		if len(other.Matchers) > 0 {
+			continue
+		}
+		if other == endpoint || !listsOverlap(endpoint.Hosts, other.Hosts) {
+			continue
+		}
+		if !maps.Equal(endpoint.Headers, other.Headers) || !maps.Equal(endpoint.Queries, other.Queries) {
+			continue
+		}
+		if !listsOverlap(endpoint.Schemes, other.Schemes) {
+			continue
+		}
+		otherPaths := endpointPaths(other)
+		for _, path := range endpointPaths(endpoint) {
+			if !containsString(otherPaths, path) {
+				continue
+			}
+			if method, ok := overlappingMethod(endpointMethods(endpoint), endpointMethods(other)); ok {
+				return fmt.Errorf("conflict: %s %s already handled", method, path)
+			}
+		}
+	}
+	return nil
+}
+
+// endpointPaths returns the path templates an endpoint registers, including the
+// prefix of its group
+func endpointPaths(endpoint *Endpoint) []string {
+	prefix := endpointPrefix(endpoint)
+	if endpoint.Paths == nil {
+		return []string{prefix + catchAllPath}
+	}
+	if prefix == "" {
+		return endpoint.Paths
+	}
+	paths := make([]string, len(endpoint.Paths))
+	for i, path := range endpoint.Paths {
+		paths[i] = prefix + path
+	}
+	return paths
+}
+
+// endpointMethods returns the methods an endpoint serves across Handler and Handlers,
+// or nil if it serves any method
+func endpointMethods(endpoint *Endpoint) []string {
+	var methods []string
+	for _, target := range methodHandlers(endpoint) {
+		if len(target.methods) == 0 {
+			return nil
+		}
+		methods = append(methods, target.methods...)
+	}
+	return methods
+}
+
+// overlappingMethod returns a method matched by both method lists, where an empty
+// list matches every method
+func overlappingMethod(a, b []string) (string, bool) {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return "*", true
+	case len(a) == 0:
+		return b[0], true
+	case len(b) == 0:
+		return a[0], true
+	}
+	for _, method := range a {
+		for _, other := range b {
+			if strings.EqualFold(method, other) {
+				return strings.ToUpper(method), true
+			}
+		}
+	}
+	return "", false
+}
+
+// listsOverlap reports whether two matcher lists can match the same request, where
+// an empty list matches everything
+func listsOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, item := range a {
+		if containsString(b, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestConflictingEndpoints(t *testing.T) {
+	dhs := newServer(t)
+	if err := dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/users/{id}"}, Handler: text("a")}); err != nil {
+		t.Fatal(err)
+	}
+	err := dhs.AddEndpoint(&Endpoint{Methods: []string{"GET", "PUT"}, Paths: []string{"/users/{id}"}, Handler: text("b")})
+	if err == nil || err.Error() != "conflict: GET /users/{id} already handled" {
+		t.Fatalf("exact collision: got %v", err)
+	}
+	if err := dhs.AddEndpoint(&Endpoint{Paths: []string{"/users/{id}"}, Handler: text("c")}); err == nil {
+		t.Fatal("an endpoint serving any method did not collide")
+	}
+	if err := dhs.AddEndpoint(&Endpoint{Methods: []string{"DELETE"}, Paths: []string{"/users/{id}"}, Handler: text("d")}); err != nil {
+		t.Fatalf("method-disjoint endpoint: %v", err)
+	}
+	if err := dhs.AddEndpoint(&Endpoint{Handler: text("e")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dhs.AddEndpoint(&Endpoint{Handler: text("f")}); err == nil {
+		t.Fatal("a second catch-all did not collide")
+	}
+	if n := len(dhs.Endpoints()); n != 3 {
+		t.Fatalf("%d endpoints registered, want 3", n)
+	}
+}
+
+func TestAllowConflicts(t *testing.T) {
+	dhs := newServer(t, WithAllowConflicts())
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/a"}, Handler: text("first")})
+	if err := dhs.AddEndpoint(&Endpoint{Paths: []string{"/a"}, Handler: text("second")}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/a", http.StatusOK, "first")
+}
+
+func TestMatchersFromOneConstructorDoNotConflict(t *testing.T) {
+	dhs := newServer(t)
+	hasHeader := func(name string) mux.MatcherFunc {
+		return func(r *http.Request, _ *mux.RouteMatch) bool {
+			return r.Header.Get(name) != ""
+		}
+	}
+	for _, endpoint := range []*Endpoint{
+		{Paths: []string{"/x"}, Matchers: []mux.MatcherFunc{hasHeader("X-A")}, Handler: text("a")},
+		{Paths: []string{"/x"}, Matchers: []mux.MatcherFunc{hasHeader("X-B")}, Handler: text("b")},
+	} {
+		if err := dhs.AddEndpoint(endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp, body := do(t, dhs, "GET", "/x", "X-A", "1"); resp.StatusCode != http.StatusOK || body != "a" {
+		t.Fatalf("X-A got %d %q", resp.StatusCode, body)
+	}
+	if resp, body := do(t, dhs, "GET", "/x", "X-B", "1"); resp.StatusCode != http.StatusOK || body != "b" {
+		t.Fatalf("X-B got %d %q", resp.StatusCode, body)
+	}
+	expect(t, dhs, "GET", "/x", http.StatusNotFound, "")
+}
@@ -0,0 +1,106 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the CORS handling installed by WithCORS
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests,
+	// "*" allowing any origin
+	AllowedOrigins []string
+	// AllowedMethods lists the methods allowed in cross-origin requests. It defaults
+	// to GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers allowed in cross-origin requests,
+	// "*" allowing whichever headers the preflight asks for
+	AllowedHeaders []string
+	// AllowCredentials lets cross-origin requests carry credentials, in which case
+	// the request origin is reflected instead of answering "*"
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// cors adds the Access-Control-* headers to responses for allowed origins, answering
+// preflight requests itself before they reach next
+func cors(opts CORSOptions, next http.Handler) http.Handler {
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		allowOrigin, ok := opts.allowOrigin(origin)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header.Set("Access-Control-Allow-Origin", allowOrigin)
+		if opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || requestMethod == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		if containsFold(methods, requestMethod) {
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if allowHeaders := opts.allowHeaders(r.Header.Get("Access-Control-Request-Headers")); allowHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", allowHeaders)
+			}
+			if opts.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, if allowed
+func (opts CORSOptions) allowOrigin(origin string) (string, bool) {
+	for _, allowed := range opts.AllowedOrigins {
+		switch {
+		case allowed == "*" && opts.AllowCredentials:
+			return origin, true
+		case allowed == "*":
+			return "*", true
+		case strings.EqualFold(allowed, origin):
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// allowHeaders returns the Access-Control-Allow-Headers value answering a preflight
+// which asked for requested
+func (opts CORSOptions) allowHeaders(requested string) string {
+	if containsString(opts.AllowedHeaders, "*") {
+		return requested
+	}
+	return strings.Join(opts.AllowedHeaders, ", ")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
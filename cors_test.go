@@ -0,0 +1,65 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	var reached bool
+	dhs := newServer(t, WithCORS(CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "PUT"},
+		AllowedHeaders: []string{"Content-Type", "X-Token"},
+		MaxAge:         10 * time.Minute,
+	}))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/items"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}})
+	resp, _ := do(t, dhs, "OPTIONS", "/items",
+		"Origin", "https://app.example.com",
+		"Access-Control-Request-Method", "PUT",
+		"Access-Control-Request-Headers", "x-token")
+	if resp.StatusCode != http.StatusNoContent || reached {
+		t.Fatalf("preflight got %d, reached handler %v", resp.StatusCode, reached)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, PUT",
+		"Access-Control-Allow-Headers": "Content-Type, X-Token",
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("%s is %q, want %q", name, got, want)
+		}
+	}
+	resp, _ = do(t, dhs, "OPTIONS", "/items",
+		"Origin", "https://evil.example.com",
+		"Access-Control-Request-Method", "PUT")
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("preflight from a disallowed origin was allowed")
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	dhs := newServer(t, WithCORS(CORSOptions{AllowedOrigins: []string{"*"}}))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/items"}, Handler: text("items")})
+	resp, body := do(t, dhs, "GET", "/items", "Origin", "https://any.example.com")
+	if resp.StatusCode != http.StatusOK || body != "items" {
+		t.Fatalf("got %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Access-Control-Allow-Origin is %q", got)
+	}
+}
+
+func TestCORSCredentialsReflectOrigin(t *testing.T) {
+	dhs := newServer(t, WithCORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/items"}, Handler: text("items")})
+	resp, _ := do(t, dhs, "GET", "/items", "Origin", "https://app.example.com")
+	if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("headers %v", resp.Header)
+	}
+}
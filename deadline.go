@@ -0,0 +1,59 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ClientTimeoutHeader carries the time budget a client grants a request, as a Go
+// duration such as "5s" or a number of seconds
+const ClientTimeoutHeader = "X-Request-Timeout"
+
+// WithClientDeadline returns middleware bounding the context of requests carrying a
+// ClientTimeoutHeader by the budget it states, capped at maxTimeout. Requests without
+// a valid positive budget keep their context. Pass it to Use or to
+// Endpoint.Middleware. It panics unless maxTimeout is positive.
+func WithClientDeadline(maxTimeout time.Duration) Middleware {
+	if maxTimeout <= 0 {
+		panic(fmt.Sprintf("dynhttpsrv: invalid client deadline cap %v", maxTimeout))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout, ok := parseClientTimeout(r.Header.Get(ClientTimeoutHeader))
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if timeout > maxTimeout {
+				timeout = maxTimeout
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// parseClientTimeout parses a ClientTimeoutHeader value, reporting whether it holds
+// a positive budget
+func parseClientTimeout(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(seconds) {
+			return 0, false
+		}
+		if seconds >= math.MaxInt64/float64(time.Second) {
+			return math.MaxInt64, true
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	return timeout, timeout > 0
+}
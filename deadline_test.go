@@ -0,0 +1,91 @@
+package dynhttpsrv
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseClientTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"5s", 5 * time.Second, true},
+		{"250ms", 250 * time.Millisecond, true},
+		{"2", 2 * time.Second, true},
+		{"0.5", 500 * time.Millisecond, true},
+		{"1e300", math.MaxInt64, true},
+		{"", 0, false},
+		{"0", 0, false},
+		{"-1s", 0, false},
+		{"soon", 0, false},
+		{"NaN", 0, false},
+	}
+	for _, test := range tests {
+		got, ok := parseClientTimeout(test.value)
+		if ok != test.ok || ok && got != test.want {
+			t.Errorf("parseClientTimeout(%q) = %v, %v, want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	dhs := newServer(t)
+	var deadline time.Time
+	var bounded bool
+	dhs.AddEndpoint(&Endpoint{
+		Paths:      []string{"/"},
+		Middleware: []Middleware{WithClientDeadline(2 * time.Second)},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			deadline, bounded = r.Context().Deadline()
+		},
+	})
+	tests := []struct {
+		header string
+		budget time.Duration
+	}{
+		{"500ms", 500 * time.Millisecond},
+		{"1", time.Second},
+		{"1h", 2 * time.Second},
+		{"", 0},
+		{"later", 0},
+	}
+	for _, test := range tests {
+		var header []string
+		if test.header != "" {
+			header = []string{ClientTimeoutHeader, test.header}
+		}
+		start := time.Now()
+		do(t, dhs, "GET", "/", header...)
+		end := time.Now()
+		if test.budget == 0 {
+			if bounded {
+				t.Errorf("%q: context bounded", test.header)
+			}
+			continue
+		}
+		if !bounded {
+			t.Errorf("%q: context unbounded", test.header)
+			continue
+		}
+		if deadline.Before(start.Add(test.budget)) || deadline.After(end.Add(test.budget)) {
+			t.Errorf("%q: deadline %v after the request, want %v", test.header, deadline.Sub(start), test.budget)
+		}
+	}
+}
+
+func TestWithClientDeadlineRejectsInvalidCap(t *testing.T) {
+	for _, maxTimeout := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithClientDeadline(%v) did not panic", maxTimeout)
+				}
+			}()
+			WithClientDeadline(maxTimeout)
+		}()
+	}
+}
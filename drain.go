@@ -0,0 +1,126 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrDrainTimeout is the cause, as reported by context.Cause, of the contexts of
+// requests still in flight once the drain timeout set through WithDrainTimeout
+// elapsed during shutdown
+var ErrDrainTimeout = errors.New("shutdown drain timeout elapsed")
+
+// ShutdownPhase tells how far shutdown had to go before every request finished
+type ShutdownPhase int32
+
+const (
+	// ShutdownPending means the server has not finished shutting down
+	ShutdownPending ShutdownPhase = iota
+	// ShutdownDrained means in-flight requests finished on their own in time
+	ShutdownDrained
+	// ShutdownCancelled means in-flight requests finished within the shutdown
+	// timeout once their contexts were cancelled at the drain timeout
+	ShutdownCancelled
+	// ShutdownForced means connections still active at the shutdown timeout were
+	// force-closed
+	ShutdownForced
+)
+
+func (p ShutdownPhase) String() string {
+	switch p {
+	case ShutdownDrained:
+		return "drained"
+	case ShutdownCancelled:
+		return "cancelled"
+	case ShutdownForced:
+		return "forced"
+	}
+	return "pending"
+}
+
+// ShutdownPhase reports which phase shutdown completed in, or ShutdownPending
+// until it finished
+func (dhs *DynHttpSrv) ShutdownPhase() ShutdownPhase {
+	return ShutdownPhase(dhs.shutdownPhase.Load())
+}
+
+// DelEndpointAndWait removes endpoint like DelEndpoint, then blocks until the
+// requests it was serving, including ones a Timeout already answered, completed
+// or ctx is done, so resources its handler uses can be released safely. An
+// endpoint with a Closer is closed by then too.
+func (dhs *DynHttpSrv) DelEndpointAndWait(endpoint *Endpoint, ctx context.Context) error {
+	if err := dhs.DelEndpoint(endpoint); err != nil {
+		return err
+	}
+	if err := dhs.FlushReload(); err != nil {
+		return err
+	}
+	dhs.mu.Lock()
+	inflight := endpoint.inflight
+	closed := endpoint.closed
+	dhs.mu.Unlock()
+	if inflight != nil {
+		if err := inflight.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if closed == nil {
+		return nil
+	}
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// inflightCounter counts the requests an endpoint is serving
+type inflightCounter struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+func newInflightCounter() *inflightCounter {
+	idle := make(chan struct{})
+	close(idle)
+	return &inflightCounter{idle: idle}
+}
+
+// track counts the requests next is serving. Nested tracking by the same counter
+// keeps a request counted until the innermost handler returned.
+func (c *inflightCounter) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		if c.n == 0 {
+			c.idle = make(chan struct{})
+		}
+		c.n++
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			c.n--
+			if c.n == 0 {
+				close(c.idle)
+			}
+			c.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wait blocks until no request is counted or ctx is done
+func (c *inflightCounter) wait(ctx context.Context) error {
+	c.mu.Lock()
+	idle := c.idle
+	c.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
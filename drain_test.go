@@ -0,0 +1,117 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDelEndpointAndWait(t *testing.T) {
+	dhs := newServer(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	endpoint := &Endpoint{Paths: []string{"/plugin"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		close(finished)
+	}}
+	dhs.AddEndpoint(endpoint)
+	go dhs.ServeRequest(httptest.NewRequest("GET", "/plugin", nil))
+	<-started
+
+	waited := make(chan error, 1)
+	go func() { waited <- dhs.DelEndpointAndWait(endpoint, context.Background()) }()
+	select {
+	case err := <-waited:
+		t.Fatalf("DelEndpointAndWait returned %v while a request was in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	expect(t, dhs, "GET", "/plugin", http.StatusNotFound, "")
+	close(release)
+	if err := <-waited; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Fatal("DelEndpointAndWait returned before the request finished")
+	}
+}
+
+func TestDelEndpointAndWaitTimeout(t *testing.T) {
+	dhs := newServer(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	endpoint := &Endpoint{Paths: []string{"/stuck"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}}
+	dhs.AddEndpoint(endpoint)
+	go dhs.ServeRequest(httptest.NewRequest("GET", "/stuck", nil))
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := dhs.DelEndpointAndWait(endpoint, ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DelEndpointAndWait = %v", err)
+	}
+	if err := dhs.DelEndpointAndWait(&Endpoint{}, context.Background()); err == nil {
+		t.Fatal("DelEndpointAndWait of an unregistered endpoint returned no error")
+	}
+}
+
+func TestShutdownPhases(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler func(t *testing.T, r *http.Request)
+		phase   ShutdownPhase
+		status  int
+	}{
+		{"drained", func(t *testing.T, r *http.Request) { time.Sleep(20 * time.Millisecond) }, ShutdownDrained, http.StatusOK},
+		{"cancelled", func(t *testing.T, r *http.Request) {
+			<-r.Context().Done()
+			if cause := context.Cause(r.Context()); !errors.Is(cause, ErrDrainTimeout) {
+				t.Errorf("request context cancelled with cause %v", cause)
+			}
+		}, ShutdownCancelled, http.StatusOK},
+		{"forced", func(t *testing.T, r *http.Request) { time.Sleep(5 * time.Second) }, ShutdownForced, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			dhs, client := NewTestServer(ctx, WithLogger(nil), WithDrainTimeout(100*time.Millisecond), WithShutdownTimeout(300*time.Millisecond))
+			started := make(chan struct{})
+			dhs.AddEndpoint(&Endpoint{Paths: []string{"/work"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				tc.handler(t, r)
+				w.Write([]byte("done"))
+			}})
+			statuses := make(chan int, 1)
+			go func() {
+				resp, err := client.Get("http://test/work")
+				if err != nil {
+					statuses <- 0
+					return
+				}
+				resp.Body.Close()
+				statuses <- resp.StatusCode
+			}()
+			<-started
+			cancel()
+			waitDone(t, dhs, 5*time.Second)
+			if phase := dhs.ShutdownPhase(); phase != tc.phase {
+				t.Fatalf("shutdown phase %v, want %v", phase, tc.phase)
+			}
+			if status := <-statuses; status != tc.status {
+				t.Fatalf("in-flight request got %d, want %d", status, tc.status)
+			}
+			if err := dhs.ServerError(); (tc.phase == ShutdownForced) != errors.Is(err, ErrShutdownTimeout) {
+				t.Fatalf("ServerError is %v", err)
+			}
+		})
+	}
+}
@@ -2,132 +2,1379 @@ package dynhttpsrv
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// ErrShutdownTimeout is reported by ServerError when in-flight requests did not
+// finish within the shutdown timeout and their connections were forcibly closed
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
+// defaultShutdownTimeout bounds how long shutdown waits for in-flight requests
+const defaultShutdownTimeout = 30 * time.Second
+
+// defaultReadHeaderTimeout bounds how long clients may take to send request
+// headers, so slow ones cannot tie up connections, unless a ReadTimeout applies
+const defaultReadHeaderTimeout = 10 * time.Second
+
+// swappableRouter serves through whichever router was swapped in last. Reads on the
+// request path are lock-free.
 type swappableRouter struct {
-	mu     *sync.Mutex
-	router *mux.Router
+	current atomic.Pointer[routerState]
+}
+
+// swappableRouter must only be used through a pointer, as it holds an atomic value
+// which must not be copied
+var _ http.Handler = (*swappableRouter)(nil)
+
+// routerState is a router along with the handler serving it, which is the router
+// wrapped in any server-wide middleware
+type routerState struct {
+	router  *mux.Router
+	handler http.Handler
+	// endpoints maps every route of router to the endpoint it was registered for
+	endpoints map[*mux.Route]*Endpoint
 }
 
 func createSwappableRouter(router *mux.Router) *swappableRouter {
-	return &swappableRouter{
-		mu:     &sync.Mutex{},
-		router: router,
-	}
+	sr := &swappableRouter{}
+	sr.swap(&routerState{router: router, handler: router})
+	return sr
+}
+
+// swap installs state, whose handler is its router wrapped in any server-wide
+// middleware
+func (sr *swappableRouter) swap(state *routerState) {
+	sr.current.Store(state)
 }
 
-func (sr *swappableRouter) swap(newRouter *mux.Router) {
-	sr.mu.Lock()
-	sr.router = newRouter
-	sr.mu.Unlock()
+// state returns the router currently serving requests along with its routes
+func (sr *swappableRouter) state() *routerState {
+	return sr.current.Load()
 }
 
-func (sr swappableRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	sr.mu.Lock()
-	router := sr.router
-	sr.mu.Unlock()
-	router.ServeHTTP(w, r)
+func (sr *swappableRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sr.current.Load().handler.ServeHTTP(w, r)
 }
 
+// Middleware wraps a handler with cross-cutting logic. A request goes through, from
+// outermost to innermost:
+//
+//   - the server-wide wrappers enabled by options, such as WithRequestID,
+//     WithAccessLog and WithCORS
+//   - the UseAfter hooks
+//   - the Use middleware, which also sees requests matching no endpoint
+//   - routing
+//   - the per-endpoint wrappers enabled by options, such as WithRecovery and
+//     WithRouteMiddleware, then the endpoint's ExpectContinueHandler,
+//     MaxBodySize, Uploads, Timeout and MaxConcurrent limits
+//   - the middleware of the Group the endpoint belongs to
+//   - the endpoint's own Middleware
+//   - the endpoint's Handler
+//
+// Within each list of middleware the first element runs outermost.
+type Middleware func(http.Handler) http.Handler
+
 type Endpoint struct {
+	// Methods restricts the endpoint to these methods. A nil or empty Methods, or
+	// one listing AllMethods, matches any method. Listing GET also serves HEAD
+	// unless the server was created WithStrictMethods.
 	Methods []string
 	Paths   []string
 	Handler func(res http.ResponseWriter, req *http.Request)
+
+	// Name identifies the endpoint's route to URL, built from its first host and
+	// path. Names must be unique across the endpoints of a server.
+	Name string
+
+	// Version tells Sync apart endpoints which would otherwise look the same, as
+	// their handlers and middleware cannot be compared. An endpoint whose Version is
+	// set keeps serving when Sync gets one with the same Version and settings.
+	Version string
+
+	// HandlerObj serves the endpoint in place of Handler, so an http.Handler such as
+	// an http.FileServer plugs in without an adapter. Setting both is an error.
+	HandlerObj http.Handler
+
+	// Handlers overrides Handler for the methods it lists, Handler then serving the
+	// remaining methods, if any
+	Handlers map[string]http.HandlerFunc
+
+	// Hosts restricts the endpoint to requests for these hosts, which may be mux
+	// host templates. A nil Hosts matches any host.
+	Hosts []string
+
+	// Headers and Queries restrict the endpoint to requests carrying every listed
+	// header or query parameter with the given value, which may be a mux pattern
+	Headers map[string]string
+	Queries map[string]string
+
+	// Schemes restricts the endpoint to requests made over these schemes, "http" or
+	// "https". Requests over another scheme are redirected to the first one on
+	// servers created WithSchemeRedirect and otherwise go on to the other routes.
+	Schemes []string
+
+	// Matchers restricts the endpoint to requests every one of them accepts, for
+	// conditions the other fields cannot express such as a valid signature header.
+	// As they cannot be compared, endpoints with Matchers never conflict.
+	Matchers []mux.MatcherFunc
+
+	// Middleware wraps only this endpoint's Handler, the first element running outermost
+	Middleware []Middleware
+
+	// Priority orders route matching: endpoints with a higher Priority are matched
+	// first, endpoints with equal Priority in registration order. Endpoints without
+	// Paths are only ordered among themselves, after all the others.
+	Priority int
+
+	// Timeout bounds how long the handler may run before the client gets a 503 and
+	// the request context is cancelled with ErrServerTimeout as its cause. Zero uses
+	// the server default set through WithRequestTimeout; a negative value disables
+	// the timeout, as streaming endpoints need.
+	Timeout time.Duration
+
+	// MaxBodySize caps the request body in bytes, answering 413 to requests declaring
+	// a larger one. Zero uses the server default set through WithMaxBodySize; a
+	// negative value lifts the cap.
+	MaxBodySize int64
+
+	// Disabled keeps the endpoint registered but out of the router, so its requests
+	// go on to the other routes. SetEndpointEnabled toggles it.
+	Disabled bool
+
+	// Uploads, if set, restricts the multipart/form-data uploads the endpoint accepts
+	Uploads *UploadLimits
+
+	// ExpectContinueHandler, if set, vets requests sending "Expect: 100-continue"
+	// before their body is read. Returning false rejects the request with the
+	// returned status, 417 if zero, without the client ever sending the body.
+	ExpectContinueHandler func(req *http.Request) (status int, ok bool)
+
+	// MaxConcurrent caps how many requests the endpoint handles at once, answering
+	// 503 to the ones arriving while it is saturated. Zero means no limit.
+	MaxConcurrent int
+
+	// OnWriteError, if set, is called once a request to the endpoint is served if
+	// writing its response failed, typically because the client went away
+	OnWriteError func(req *http.Request, err error)
+
+	// Closer, if set, releases resources the endpoint holds. It is called once the
+	// endpoint was removed from the router and the requests it was serving
+	// completed. Without it a HandlerObj implementing io.Closer is closed instead.
+	Closer io.Closer
+
+	// group is the Group the endpoint was registered through, if any
+	group *Group
+	// slots is the semaphore enforcing MaxConcurrent, kept across reloads
+	slots chan struct{}
+	// inflight counts the requests the endpoint is serving, kept across reloads
+	inflight *inflightCounter
+	// id is the ID given to the endpoint when it was first added
+	id EndpointID
+	// generation changes whenever the endpoint is added, set or updated, telling
+	// the routing fingerprint its functions may have changed
+	generation uint64
+	// closed is closed once the endpoint's Closer ran after its last removal
+	closed chan struct{}
 }
 
 type DynHttpSrv struct {
 	Router    *swappableRouter
-	Endpoints []*Endpoint
+	endpoints []*Endpoint
+
+	// mu guards endpoints, middleware and afterHooks and serializes router reloads
+	mu         *sync.Mutex
+	middleware []Middleware
+	afterHooks []func(*RequestInfo)
+
+	// settingsVersion is bumped whenever a server-wide routing setting changes and
+	// routerFingerprint identifies the state the live router was built from
+	settingsVersion   uint64
+	routerFingerprint uint64
+
+	// reloadDebounce delays router rebuilds, reloadPending telling whether one is
+	// scheduled on reloadTimer
+	reloadDebounce time.Duration
+	reloadPending  bool
+	reloadTimer    *time.Timer
+
+	// liveEndpoints are the endpoints the live router was built from
+	liveEndpoints []*Endpoint
+
+	// reloadHooks are notified with reloaded, the endpoints of a router swapped in
+	// while dhs.mu was held, once it is released
+	reloadHooks []func(endpoints []*Endpoint)
+	reloaded    []*Endpoint
+
+	server   *http.Server
+	listener net.Listener
+	bound    chan struct{}
+	ready    chan struct{}
+	done     chan struct{}
+	err      error
+
+	// serveListener wraps listener for Serve and acceptStopped is set once
+	// StopAccepting closed it
+	serveListener *onceCloseListener
+	acceptStopped atomic.Bool
+	stats         *serverStats
+
+	// listenersMu guards extraListeners, which AddListener appends to, and
+	// keepAlivesDisabled, which applies to every listener
+	listenersMu        sync.Mutex
+	extraListeners     []*extraListener
+	keepAlivesDisabled bool
+
+	shutdownTimeout time.Duration
+	drainTimeout    time.Duration
+	stopping        chan struct{}
+	stopCause       error
+	shutdownDone    chan struct{}
+	shutdownErr     error
+	shutdownPhase   atomic.Int32
+	shutdownHooks   []func()
+	// cancelRequests cancels the contexts of the requests the listeners serve
+	cancelRequests context.CancelCauseFunc
+
+	recovery       bool
+	panicHandler   PanicHandler
+	allowConflicts bool
+	skipValidation bool
+
+	certFile   string
+	keyFile    string
+	socketMode os.FileMode
+	reusePort  bool
+	h2c        bool
+	servesTLS  bool
+	// certificate is the certificate set through SetCertificate, if any
+	certificate atomic.Pointer[tls.Certificate]
+	// maintenance is set while SetMaintenance turned maintenance mode on
+	maintenance atomic.Pointer[maintenance]
+
+	notFoundHandler         http.HandlerFunc
+	methodNotAllowedHandler http.HandlerFunc
+	fallback                *Endpoint
+	strictSlash             bool
+	skipClean               bool
+	useEncodedPath          bool
+	strictMethods           bool
+	autoOptions             bool
+	schemeRedirect          bool
+	pathPrefix              string
+	mergeSlashes            bool
+	maxConns                int
+	trustForwardedProto     bool
+
+	logger       *slog.Logger
+	accessLogger *slog.Logger
+	requestID    bool
+	metricsSink  MetricsSink
+	cors         *CORSOptions
+
+	compression          bool
+	compressionLevel     int
+	compressionThreshold int
+
+	rateLimiter       *rateLimiter
+	rateLimitKey      func(*http.Request) string
+	trustForwardedFor bool
+
+	routeMiddleware []Middleware
+	requestTimeout  time.Duration
+	maxBodySize     int64
+}
+
+// New creates a new dynamic HTTP server listening on address and obeying cancelling through ctx.
+// An address of the form "unix:/path/to/sock" listens on a Unix domain socket.
+func New(ctx context.Context, addr string, opts ...Option) *DynHttpSrv {
+	dhs, err := newChecked(ctx, addr, opts)
+	if err != nil {
+		dhs.logger.Error("Listen ended with error", "error", err)
+	}
+	return dhs
+}
+
+// NewChecked is like New but binds the listener before returning, so failing to
+// listen on addr is reported right away. Errors ending the server later are reported
+// by ServerError.
+func NewChecked(ctx context.Context, addr string, opts ...Option) (*DynHttpSrv, error) {
+	dhs, err := newChecked(ctx, addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return dhs, nil
 }
 
-// New creates a new dynamic HTTP server listening on address and obeying cancelling through ctx
-func New(ctx context.Context, addr string) *DynHttpSrv {
+// newChecked binds addr and starts serving on it. If binding fails, the returned
+// server reports the error through Addr and ServerError.
+func newChecked(ctx context.Context, addr string, opts []Option) (*DynHttpSrv, error) {
+	dhs := create(addr, opts)
+	err := dhs.err
+	var ln net.Listener
+	if err == nil {
+		ln, err = dhs.listen(addr)
+	}
+	if err != nil {
+		dhs.err = err
+		close(dhs.bound)
+		close(dhs.done)
+		return dhs, err
+	}
+	dhs.start(ctx, ln)
+	return dhs, nil
+}
+
+// NewWithListener creates a new dynamic HTTP server serving on ln, which it closes
+// on shutdown, and obeying cancelling through ctx
+func NewWithListener(ctx context.Context, ln net.Listener, opts ...Option) *DynHttpSrv {
+	dhs := create(ln.Addr().String(), opts)
+	dhs.start(ctx, ln)
+	return dhs
+}
+
+// create builds a server for addr configured by opts, which is not serving yet
+func create(addr string, opts []Option) *DynHttpSrv {
 	srvMux := createSwappableRouter(mux.NewRouter().StrictSlash(true))
 	srv := &http.Server{
 		Addr:    addr,
 		Handler: srvMux,
 	}
 
+	dhs := &DynHttpSrv{
+		Router:    srvMux,
+		endpoints: make([]*Endpoint, 0),
+		mu:        &sync.Mutex{},
+		server:    srv,
+		bound:     make(chan struct{}),
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+		stats:     newServerStats(),
+
+		shutdownTimeout: defaultShutdownTimeout,
+		stopping:        make(chan struct{}),
+		shutdownDone:    make(chan struct{}),
+
+		compressionThreshold: defaultCompressionThreshold,
+		strictSlash:          true,
+		logger:               slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(dhs)
+	}
+	if srv.ReadHeaderTimeout == 0 && srv.ReadTimeout <= 0 {
+		srv.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	dhs.servesTLS = dhs.configuredTLS()
+	if dhs.servesTLS {
+		dhs.err = dhs.installGetCertificate()
+	}
+	if dhs.logger == nil {
+		dhs.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	srv.ErrorLog = slog.NewLogLogger(dhs.logger.Handler(), slog.LevelError)
+	dhs.mu.Lock()
+	dhs.applyReload()
+	dhs.unlock()
+	srv.Handler = dhs.serverHandler()
+	srv.ConnState = dhs.stats.connState
+	requestsCtx, cancelRequests := context.WithCancelCause(context.WithValue(context.Background(), serverKey{}, dhs))
+	dhs.cancelRequests = cancelRequests
+	srv.BaseContext = func(net.Listener) context.Context {
+		return requestsCtx
+	}
+	return dhs
+}
+
+// start serves on ln in the background until ctx is cancelled
+func (dhs *DynHttpSrv) start(ctx context.Context, ln net.Listener) {
+	dhs.listener = ln
+	dhs.serveListener = newOnceCloseListener(dhs.limitConns(ln))
+	close(dhs.bound)
+	close(dhs.ready)
+
+	// exited is closed when serving ends without a shutdown, which the watcher
+	// then no longer waits for
+	exited := make(chan struct{})
 	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			log.Printf("ListenAndServe ended with error: %v\n", err)
+		defer close(dhs.done)
+		var err error
+		if dhs.usesTLS() {
+			err = dhs.server.ServeTLS(dhs.serveListener, "", "")
+		} else {
+			err = dhs.server.Serve(dhs.serveListener)
+		}
+		if err == http.ErrServerClosed || dhs.acceptStopped.Load() {
+			<-dhs.shutdownDone
+			err = dhs.shutdownErr
+			if err != nil {
+				err = fmt.Errorf("%w: shutdown caused by %w", err, dhs.stopCause)
+			}
+		} else {
+			close(exited)
+		}
+		if err != nil {
+			dhs.logger.Error("ListenAndServe ended with error", "error", err)
+			dhs.err = err
 		}
-		log.Printf("ListenAndServe exited\n")
+		dhs.logger.Info("ListenAndServe exited")
 	}()
 
 	go func() {
-		for {
-			if ctx.Err() == context.Canceled {
-				srv.Shutdown(context.Background())
-				break
-			}
-			time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+		case <-exited:
+			return
 		}
+		dhs.stopCause = context.Cause(ctx)
+		close(dhs.stopping)
+		dhs.logger.Info("Shutting down", "cause", dhs.stopCause)
+		defer close(dhs.shutdownDone)
+		dhs.runShutdownHooks()
+		dhs.shutdownErr = dhs.shutdown()
 	}()
+}
 
-	return &DynHttpSrv{
-		Router:    srvMux,
-		Endpoints: make([]*Endpoint, 0),
+// serverHandler wraps the swappable router in the server-wide wrappers configured
+// through options, which therefore survive router reloads
+func (dhs *DynHttpSrv) serverHandler() http.Handler {
+	var handler http.Handler = clientCause(dhs.Router)
+	if dhs.trustForwardedProto {
+		handler = forwardedProto(handler)
+	}
+	if dhs.cors != nil {
+		handler = cors(*dhs.cors, handler)
+	}
+	if dhs.compression {
+		handler = compression(dhs.compressionLevel, dhs.compressionThreshold, handler)
+	}
+	handler = dhs.inMaintenance(handler)
+	if dhs.rateLimiter != nil {
+		key := dhs.rateLimitKey
+		if key == nil {
+			key = dhs.clientIP
+		}
+		handler = rateLimit(dhs.rateLimiter, key, handler)
 	}
+	if dhs.metricsSink != nil {
+		handler = metrics(dhs.metricsSink, handler)
+	}
+	if dhs.accessLogger != nil {
+		handler = accessLog(dhs.accessLogger, handler)
+	}
+	if dhs.requestID {
+		handler = requestID(handler)
+	}
+	handler = dhs.stats.countRequests(handler)
+	if dhs.h2c {
+		handler = h2cHandler(handler)
+	}
+	return handler
+}
+
+// clientIP returns the address of the client which sent r
+func (dhs *DynHttpSrv) clientIP(r *http.Request) string {
+	return clientIP(r, dhs.trustForwardedFor)
+}
+
+// IsShuttingDown reports whether the server's context has been cancelled, which
+// happens before in-flight requests are drained
+func (dhs *DynHttpSrv) IsShuttingDown() bool {
+	select {
+	case <-dhs.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// StopCause returns the cause of the cancellation of the server's context, as
+// reported by context.Cause, or nil while it is not shutting down
+func (dhs *DynHttpSrv) StopCause() error {
+	select {
+	case <-dhs.stopping:
+		return dhs.stopCause
+	default:
+		return nil
+	}
+}
+
+// OnShutdown registers fn to run once the server starts shutting down, before
+// in-flight requests are drained, for example to deregister from service discovery.
+// Hooks run in registration order.
+func (dhs *DynHttpSrv) OnShutdown(fn func()) {
+	dhs.mu.Lock()
+	defer dhs.mu.Unlock()
+	dhs.shutdownHooks = append(dhs.shutdownHooks, fn)
+}
+
+func (dhs *DynHttpSrv) runShutdownHooks() {
+	dhs.mu.Lock()
+	hooks := dhs.shutdownHooks
+	dhs.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// shutdown gracefully stops the server and its extra listeners. Once the drain
+// timeout elapses the contexts of in-flight requests are cancelled, and once the
+// shutdown timeout elapses the connections still active are force-closed.
+func (dhs *DynHttpSrv) shutdown() error {
+	// Idle connections then close as soon as their current request is answered
+	dhs.SetKeepAlivesEnabled(false)
+	shutdownCtx := context.Background()
+	if dhs.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, dhs.shutdownTimeout)
+		defer cancel()
+	}
+	phase := ShutdownDrained
+	var err error
+	if dhs.drainTimeout > 0 {
+		drainCtx, cancel := context.WithTimeout(shutdownCtx, dhs.drainTimeout)
+		err = dhs.shutdownServers(drainCtx)
+		cancel()
+		if err != nil && shutdownCtx.Err() == nil {
+			phase = ShutdownCancelled
+			dhs.cancelRequests(ErrDrainTimeout)
+			err = dhs.shutdownServers(shutdownCtx)
+		}
+	} else {
+		err = dhs.shutdownServers(shutdownCtx)
+	}
+	if err != nil {
+		phase = ShutdownForced
+		dhs.closeServers()
+	}
+	dhs.awaitExtraListeners()
+	dhs.shutdownPhase.Store(int32(phase))
+	dhs.logger.Info("Shutdown finished", "phase", phase)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrShutdownTimeout
+	}
+	return err
+}
+
+// Ready returns a channel which is closed once the server is accepting connections
+func (dhs *DynHttpSrv) Ready() <-chan struct{} {
+	return dhs.ready
+}
+
+// Addr blocks until the listener is bound and returns its address, or returns the
+// error if binding failed. It is useful when listening on ":0".
+func (dhs *DynHttpSrv) Addr() (net.Addr, error) {
+	<-dhs.bound
+	if dhs.listener == nil {
+		return nil, dhs.err
+	}
+	return dhs.listener.Addr(), nil
+}
+
+// Done returns a channel which is closed once the server has stopped serving and
+// shutdown has completed
+func (dhs *DynHttpSrv) Done() <-chan struct{} {
+	return dhs.done
+}
+
+// Wait blocks until the server has stopped serving and shutdown has completed,
+// which after the context is cancelled takes at most the shutdown timeout
+func (dhs *DynHttpSrv) Wait() {
+	<-dhs.done
+}
+
+// ServerError blocks until the server stops and returns the error which stopped it,
+// ErrShutdownTimeout if connections had to be forcibly closed, or nil if it was
+// shut down cleanly. Shutdown errors also wrap the StopCause.
+func (dhs *DynHttpSrv) ServerError() error {
+	<-dhs.done
+	return dhs.err
 }
 
 func (dhs *DynHttpSrv) AddEndpoint(endpoint *Endpoint) error {
-	pos := -1
-	for i, existingEndpoint := range dhs.Endpoints {
-		if existingEndpoint == endpoint {
-			pos = i
-			break
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	return dhs.addEndpoints(nil, []*Endpoint{endpoint})
+}
+
+// AddEndpoints adds all endpoints reloading the router once. If any of them cannot
+// be added, none is.
+func (dhs *DynHttpSrv) AddEndpoints(endpoints ...*Endpoint) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	return dhs.addEndpoints(nil, endpoints)
+}
+
+// addEndpoints adds endpoints as members of group, which is nil for ungrouped
+// endpoints, reloading the router once. Callers must hold dhs.mu.
+func (dhs *DynHttpSrv) addEndpoints(group *Group, endpoints []*Endpoint) error {
+	for _, endpoint := range endpoints {
+		if dhs.indexOf(endpoint) != -1 {
+			return errors.New("endpoint already added")
 		}
 	}
-	if pos != -1 {
-		return errors.New("endpoint already added")
+	revert := assignGroup(endpoints, group)
+	if err := dhs.checkEndpoints(dhs.endpoints, endpoints); err != nil {
+		revert()
+		return err
+	}
+	dhs.endpoints = append(dhs.endpoints, endpoints...)
+	touch(endpoints)
+	dhs.assignIDs()
+	if err := dhs.reloadEndpoints(); err != nil {
+		revert()
+		return err
+	}
+	return nil
+}
+
+// SetEndpoints replaces all registered endpoints with endpoints, reloading the router
+// once. If endpoints are not valid together, the registered ones are kept.
+func (dhs *DynHttpSrv) SetEndpoints(endpoints []*Endpoint) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	revert := assignGroup(endpoints, nil)
+	if err := dhs.checkEndpoints(nil, endpoints); err != nil {
+		revert()
+		return err
+	}
+	dhs.endpoints = append(make([]*Endpoint, 0, len(endpoints)), endpoints...)
+	touch(endpoints)
+	dhs.assignIDs()
+	if err := dhs.reloadEndpoints(); err != nil {
+		revert()
+		return err
 	}
-	dhs.Endpoints = append(dhs.Endpoints, endpoint)
-	dhs.reloadEndpoints()
 	return nil
 }
 
 func (dhs *DynHttpSrv) DelEndpoint(endpoint *Endpoint) error {
-	pos := -1
-	for i, existingEndpoint := range dhs.Endpoints {
-		if existingEndpoint == endpoint {
-			pos = i
-			break
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	pos := dhs.indexOf(endpoint)
+	if pos == -1 {
+		return errors.New("endpoint not found")
+	}
+	dhs.endpoints = append(dhs.endpoints[0:pos], dhs.endpoints[pos+1:]...)
+	return dhs.reloadEndpoints()
+}
+
+// SetEndpointEnabled puts endpoint back into the router or takes it out while
+// keeping it registered, reloading the router if that changed anything
+func (dhs *DynHttpSrv) SetEndpointEnabled(endpoint *Endpoint, enabled bool) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	if dhs.indexOf(endpoint) == -1 {
+		return errors.New("endpoint not found")
+	}
+	if endpoint.Disabled == !enabled {
+		return nil
+	}
+	endpoint.Disabled = !enabled
+	if err := dhs.reloadEndpoints(); err != nil {
+		endpoint.Disabled = enabled
+		return err
+	}
+	return nil
+}
+
+// DelEndpointByPath removes every endpoint serving path, reloading the router once,
+// and returns how many were removed
+func (dhs *DynHttpSrv) DelEndpointByPath(path string) (int, error) {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	removed, err := dhs.delEndpointsWhere(func(endpoint *Endpoint) bool {
+		return containsString(endpointPaths(endpoint), path)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, errors.New("endpoint not found")
+	}
+	return removed, nil
+}
+
+// DelEndpointByMethodPath removes every endpoint serving method on path, reloading
+// the router once, and returns how many were removed
+func (dhs *DynHttpSrv) DelEndpointByMethodPath(method, path string) (int, error) {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	removed, err := dhs.delEndpointsWhere(func(endpoint *Endpoint) bool {
+		methods := endpointMethods(endpoint)
+		return containsString(endpointPaths(endpoint), path) && (methods == nil || containsFold(methods, method))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, errors.New("endpoint not found")
+	}
+	return removed, nil
+}
+
+// RemoveAllEndpoints removes every endpoint, swapping in an empty router which still
+// honors the server-wide router settings. If the reload fails the endpoints are
+// kept.
+func (dhs *DynHttpSrv) RemoveAllEndpoints() error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	dhs.endpoints = make([]*Endpoint, 0)
+	return dhs.reloadEndpoints()
+}
+
+// delEndpointsWhere removes the endpoints for which match returns true, reloading
+// the router once if any was, and returns how many were removed. If the reload
+// fails nothing is removed. Callers must hold dhs.mu.
+func (dhs *DynHttpSrv) delEndpointsWhere(match func(*Endpoint) bool) (int, error) {
+	kept := make([]*Endpoint, 0, len(dhs.endpoints))
+	for _, endpoint := range dhs.endpoints {
+		if !match(endpoint) {
+			kept = append(kept, endpoint)
+		}
+	}
+	removed := len(dhs.endpoints) - len(kept)
+	if removed > 0 {
+		dhs.endpoints = kept
+		if err := dhs.reloadEndpoints(); err != nil {
+			return 0, err
 		}
 	}
+	return removed, nil
+}
+
+// UpdateEndpoint replaces oldEndpoint with newEndpoint in place, reloading the router
+// once so the route never goes missing in between. newEndpoint joins the group of
+// oldEndpoint, if any. Passing the same endpoint twice applies changes made to its
+// fields since it was registered.
+func (dhs *DynHttpSrv) UpdateEndpoint(oldEndpoint, newEndpoint *Endpoint) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	pos := dhs.indexOf(oldEndpoint)
 	if pos == -1 {
 		return errors.New("endpoint not found")
 	}
-	dhs.Endpoints = append(dhs.Endpoints[0:pos], dhs.Endpoints[pos+1:]...)
-	dhs.reloadEndpoints()
+	if newEndpoint != oldEndpoint && dhs.indexOf(newEndpoint) != -1 {
+		return errors.New("endpoint already added")
+	}
+	others := make([]*Endpoint, 0, len(dhs.endpoints)-1)
+	others = append(others, dhs.endpoints[:pos]...)
+	others = append(others, dhs.endpoints[pos+1:]...)
+	revert := assignGroup([]*Endpoint{newEndpoint}, oldEndpoint.group)
+	if err := dhs.checkEndpoints(others, []*Endpoint{newEndpoint}); err != nil {
+		revert()
+		return err
+	}
+	dhs.endpoints[pos] = newEndpoint
+	touch([]*Endpoint{newEndpoint})
+	dhs.assignIDs()
+	if err := dhs.reloadEndpoints(); err != nil {
+		revert()
+		return err
+	}
 	return nil
 }
 
-func (dhs *DynHttpSrv) reloadEndpoints() {
-	newRouter := mux.NewRouter().StrictSlash(true)
-	for _, endpoint := range dhs.Endpoints {
-		if endpoint.Paths == nil {
-			if endpoint.Methods == nil {
-				newRouter.PathPrefix("/").HandlerFunc(endpoint.Handler)
-			} else {
-				newRouter.PathPrefix("/").HandlerFunc(endpoint.Handler).Methods(endpoint.Methods...)
+// OnReload registers fn to be called with the registered endpoints, in registration
+// order, every time a new router has been swapped in. Hooks run in registration
+// order without holding any lock, so they may call back into the server.
+func (dhs *DynHttpSrv) OnReload(fn func(endpoints []*Endpoint)) {
+	dhs.mu.Lock()
+	defer dhs.mu.Unlock()
+	dhs.reloadHooks = append(dhs.reloadHooks, fn)
+}
+
+// unlock releases dhs.mu, then notifies the reload hooks if the router was reloaded
+// while it was held
+func (dhs *DynHttpSrv) unlock() {
+	reloaded := dhs.reloaded
+	hooks := dhs.reloadHooks
+	dhs.reloaded = nil
+	dhs.mu.Unlock()
+	if reloaded == nil {
+		return
+	}
+	for _, hook := range hooks {
+		hook(reloaded)
+	}
+}
+
+// Endpoints returns a copy of the currently registered endpoints in registration order
+func (dhs *DynHttpSrv) Endpoints() []*Endpoint {
+	dhs.mu.Lock()
+	defer dhs.mu.Unlock()
+	endpoints := make([]*Endpoint, len(dhs.endpoints))
+	copy(endpoints, dhs.endpoints)
+	return endpoints
+}
+
+// checkEndpoints verifies that endpoints can be registered alongside existing and
+// each other, returning the first problem found. Callers must hold dhs.mu.
+func (dhs *DynHttpSrv) checkEndpoints(existing, endpoints []*Endpoint) error {
+	accepted := make([]*Endpoint, 0, len(existing)+len(endpoints))
+	accepted = append(accepted, existing...)
+	for _, endpoint := range endpoints {
+		for _, other := range accepted {
+			if other == endpoint {
+				return errors.New("endpoint already added")
 			}
-		} else {
-			for _, path := range endpoint.Paths {
-				if endpoint.Methods == nil {
-					newRouter.HandleFunc(path, endpoint.Handler)
-				} else {
-					newRouter.HandleFunc(path, endpoint.Handler).Methods(endpoint.Methods...)
+		}
+		if !dhs.skipValidation {
+			if err := validateEndpoint(endpoint); err != nil {
+				return err
+			}
+		}
+		if !dhs.allowConflicts {
+			if err := routeConflict(accepted, endpoint); err != nil {
+				return err
+			}
+		}
+		if endpoint.Name != "" {
+			for _, other := range accepted {
+				if other.Name == endpoint.Name {
+					return fmt.Errorf("endpoint name %q already used", endpoint.Name)
 				}
 			}
 		}
+		accepted = append(accepted, endpoint)
+	}
+	return nil
+}
+
+// assignGroup makes endpoints members of group and returns a function restoring
+// their previous groups
+func assignGroup(endpoints []*Endpoint, group *Group) func() {
+	previous := make([]*Group, len(endpoints))
+	for i, endpoint := range endpoints {
+		previous[i] = endpoint.group
+		endpoint.group = group
+	}
+	return func() {
+		for i := len(endpoints) - 1; i >= 0; i-- {
+			endpoints[i].group = previous[i]
+		}
+	}
+}
+
+// indexOf returns the position of endpoint in endpoints, or -1. Callers must hold dhs.mu.
+func (dhs *DynHttpSrv) indexOf(endpoint *Endpoint) int {
+	for i, existingEndpoint := range dhs.endpoints {
+		if existingEndpoint == endpoint {
+			return i
+		}
+	}
+	return -1
+}
+
+// Use appends middleware wrapping the whole router, so it also runs for requests
+// which match no endpoint. Middleware registered first runs outermost. If reloading
+// the router fails mw is not kept.
+func (dhs *DynHttpSrv) Use(mw Middleware) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	dhs.middleware = append(dhs.middleware, mw)
+	dhs.settingsVersion++
+	if err := dhs.reloadEndpoints(); err != nil {
+		dhs.middleware = dhs.middleware[:len(dhs.middleware)-1]
+		return err
+	}
+	return nil
+}
+
+// SetNotFoundHandler sets the handler answering requests which match no endpoint.
+// If reloading the router fails the previous handler is kept.
+func (dhs *DynHttpSrv) SetNotFoundHandler(h http.HandlerFunc) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	previous := dhs.notFoundHandler
+	dhs.notFoundHandler = h
+	dhs.settingsVersion++
+	if err := dhs.reloadEndpoints(); err != nil {
+		dhs.notFoundHandler = previous
+		return err
+	}
+	return nil
+}
+
+// SetMethodNotAllowedHandler sets the handler answering requests whose path matches
+// an endpoint but whose method does not. If reloading the router fails the previous
+// handler is kept.
+func (dhs *DynHttpSrv) SetMethodNotAllowedHandler(h http.HandlerFunc) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	previous := dhs.methodNotAllowedHandler
+	dhs.methodNotAllowedHandler = h
+	dhs.settingsVersion++
+	if err := dhs.reloadEndpoints(); err != nil {
+		dhs.methodNotAllowedHandler = previous
+		return err
+	}
+	return nil
+}
+
+// SetFallback sets a handler for requests of any method matching no endpoint. Unlike
+// an Endpoint with nil Paths it is always registered after every endpoint, whatever
+// their Priority, and unlike the NotFoundHandler it runs endpoint wrapping such as
+// recovery and timeouts. A nil h removes it. If reloading the router fails the
+// previous fallback is kept.
+func (dhs *DynHttpSrv) SetFallback(h http.HandlerFunc) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	previous := dhs.fallback
+	dhs.fallback = nil
+	if h != nil {
+		dhs.fallback = &Endpoint{Handler: h}
+	}
+	dhs.settingsVersion++
+	if err := dhs.reloadEndpoints(); err != nil {
+		dhs.fallback = previous
+		return err
+	}
+	return nil
+}
+
+// newRouter creates an empty router honoring the server-wide router settings.
+// Callers must hold dhs.mu.
+func (dhs *DynHttpSrv) newRouter() *mux.Router {
+	// cleanPaths cleans request paths ahead of the router, see rebuildRouter
+	router := mux.NewRouter().StrictSlash(dhs.strictSlash && !dhs.mergeSlashes).SkipClean(true)
+	if dhs.useEncodedPath {
+		router.UseEncodedPath()
+	}
+	if dhs.notFoundHandler != nil {
+		router.NotFoundHandler = dhs.notFoundHandler
+	}
+	if dhs.methodNotAllowedHandler != nil {
+		router.MethodNotAllowedHandler = dhs.methodNotAllowedHandler
+	}
+	return router
+}
+
+// reloadEndpoints rebuilds the router, or with WithReloadDebounce schedules its
+// rebuild once mutations settle. If building the new router panics, the previous
+// router stays live, the endpoints are reverted to the ones it was built from and
+// the error is logged and returned. Callers must hold dhs.mu and release it
+// through dhs.unlock so the reload hooks run.
+func (dhs *DynHttpSrv) reloadEndpoints() error {
+	if dhs.reloadDebounce <= 0 {
+		return dhs.applyReload()
+	}
+	dhs.reloadPending = true
+	if dhs.reloadTimer == nil {
+		dhs.reloadTimer = time.AfterFunc(dhs.reloadDebounce, func() {
+			dhs.FlushReload()
+		})
+	} else {
+		dhs.reloadTimer.Reset(dhs.reloadDebounce)
+	}
+	return nil
+}
+
+// FlushReload immediately applies the endpoint changes a WithReloadDebounce server
+// has not applied yet, returning the error reloadEndpoints would have
+func (dhs *DynHttpSrv) FlushReload() error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	if !dhs.reloadPending {
+		return nil
+	}
+	dhs.reloadTimer.Stop()
+	return dhs.applyReload()
+}
+
+// applyReload rebuilds the router, reverting the endpoints if that fails and
+// closing the removed ones otherwise. Callers must hold dhs.mu.
+func (dhs *DynHttpSrv) applyReload() error {
+	previous := dhs.liveEndpoints
+	if err := dhs.rebuildRouter(); err != nil {
+		dhs.logger.Error("Reloading endpoints failed", "error", err)
+		dhs.endpoints = append(make([]*Endpoint, 0, len(dhs.liveEndpoints)), dhs.liveEndpoints...)
+		return err
+	}
+	dhs.closeRemoved(previous)
+	return nil
+}
+
+// rebuildRouter rebuilds the router from a snapshot of the current endpoints
+// and swaps it in, unless nothing affecting routing changed since the last
+// reload. Routes are registered by descending Priority and, within the same
+// Priority, in registration order, which Add and Del preserve for the surviving
+// endpoints. Catch-all endpoints, which have no Paths, come after all others so
+// they only get requests no specific route matches, followed by the fallback.
+// Panics raised while building are returned as errors. Callers must hold dhs.mu
+// and release it through dhs.unlock so the reload hooks run.
+func (dhs *DynHttpSrv) rebuildRouter() (err error) {
+	dhs.reloadPending = false
+	endpoints := make([]*Endpoint, 0, len(dhs.endpoints))
+	for _, endpoint := range dhs.endpoints {
+		if !endpoint.Disabled {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	live := make([]*Endpoint, len(dhs.endpoints))
+	copy(live, dhs.endpoints)
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		if catchAllI, catchAllJ := endpoints[i].Paths == nil, endpoints[j].Paths == nil; catchAllI != catchAllJ {
+			return catchAllJ
+		}
+		return endpoints[i].Priority > endpoints[j].Priority
+	})
+	fingerprint := dhs.routingFingerprint(endpoints)
+	if fingerprint == dhs.routerFingerprint {
+		dhs.liveEndpoints = live
+		return nil
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("building router: %v", recovered)
+		}
+	}()
+
+	dhs.warnSharedCatchAlls(endpoints)
+	newRouter := dhs.newRouter()
+	routes := make(map[*mux.Route]*Endpoint)
+	// Automatic HEAD routes come after the explicit routes of the endpoints with
+	// Paths, so endpoints serving HEAD themselves take precedence, but before the
+	// catch-alls, which would otherwise get HEAD requests for specific GET routes.
+	// The catch-alls' own ones follow them.
+	catchAlls := sort.Search(len(endpoints), func(i int) bool { return endpoints[i].Paths == nil })
+	for _, batch := range [][]*Endpoint{endpoints[:catchAlls], endpoints[catchAlls:]} {
+		for _, endpoint := range batch {
+			dhs.registerEndpoint(newRouter, endpoint, routes)
+		}
+		if !dhs.strictMethods {
+			for _, endpoint := range batch {
+				dhs.registerHead(newRouter, endpoint, routes)
+			}
+		}
+	}
+	if dhs.autoOptions {
+		registerOptions(newRouter, endpoints)
+	}
+	if dhs.schemeRedirect {
+		for _, endpoint := range endpoints {
+			dhs.registerSchemeRedirect(newRouter, endpoint)
+		}
+	}
+	if dhs.fallback != nil {
+		dhs.registerEndpoint(newRouter, dhs.fallback, routes)
+	}
+	var handler http.Handler = newRouter
+	for i := len(dhs.middleware) - 1; i >= 0; i-- {
+		handler = dhs.middleware[i](handler)
+	}
+	if len(dhs.afterHooks) > 0 {
+		hooks := make([]func(*RequestInfo), len(dhs.afterHooks))
+		copy(hooks, dhs.afterHooks)
+		handler = runAfter(hooks, handler)
+	}
+	if dhs.pathPrefix != "" {
+		notFound := newRouter.NotFoundHandler
+		if notFound == nil {
+			notFound = http.NotFoundHandler()
+		}
+		handler = stripPathPrefix(dhs.pathPrefix, handler, notFound)
+	}
+	if !dhs.skipClean {
+		handler = cleanPaths(dhs.useEncodedPath, handler)
+	}
+	dhs.Router.swap(&routerState{router: newRouter, handler: handler, endpoints: routes})
+	dhs.routerFingerprint = fingerprint
+	dhs.liveEndpoints = live
+	if len(dhs.reloadHooks) > 0 {
+		dhs.reloaded = make([]*Endpoint, len(dhs.endpoints))
+		copy(dhs.reloaded, dhs.endpoints)
+	}
+	return nil
+}
+
+// warnSharedCatchAlls logs a warning for every path prefix several catch-all
+// endpoints were registered for, as only the first of them may ever match
+func (dhs *DynHttpSrv) warnSharedCatchAlls(endpoints []*Endpoint) {
+	counts := make(map[string]int)
+	var prefixes []string
+	for _, endpoint := range endpoints {
+		if endpoint.Paths != nil {
+			continue
+		}
+		prefix := endpointPrefix(endpoint) + "/"
+		if counts[prefix] == 0 {
+			prefixes = append(prefixes, prefix)
+		}
+		counts[prefix]++
+	}
+	for _, prefix := range prefixes {
+		if counts[prefix] > 1 {
+			dhs.logger.Warn("Multiple catch-all endpoints registered", "prefix", prefix, "count", counts[prefix])
+		}
+	}
+}
+
+// registerEndpoint adds one route to router for every host and path combination
+// of endpoint, recording each of them in routes
+func (dhs *DynHttpSrv) registerEndpoint(router *mux.Router, endpoint *Endpoint, routes map[*mux.Route]*Endpoint) {
+	for i, target := range methodHandlers(endpoint) {
+		added := dhs.addRoutes(router, endpoint, target.methods, dhs.endpointHandler(endpoint, target.handler), routes)
+		if i == 0 && endpoint.Name != "" && len(added) > 0 {
+			added[0].Name(endpoint.Name)
+		}
+	}
+}
+
+// registerHead adds HEAD routes for the handler of endpoint serving GET, unless
+// endpoint serves HEAD explicitly too
+func (dhs *DynHttpSrv) registerHead(router *mux.Router, endpoint *Endpoint, routes map[*mux.Route]*Endpoint) {
+	targets := methodHandlers(endpoint)
+	for _, target := range targets {
+		if containsFold(target.methods, http.MethodHead) {
+			return
+		}
+	}
+	for _, target := range targets {
+		if containsFold(target.methods, http.MethodGet) {
+			// Discarding the body outside every wrapper lets those which buffer it,
+			// such as WithETag, compute the same headers as for GET
+			dhs.addRoutes(router, endpoint, []string{http.MethodHead}, withoutBody(dhs.endpointHandler(endpoint, target.handler)), routes)
+			return
+		}
+	}
+}
+
+// addRoutes adds one route serving methods with handler, as wrapped by
+// endpointHandler, to router for every host and path combination of endpoint,
+// recording each of them in routes, and returns them
+func (dhs *DynHttpSrv) addRoutes(router *mux.Router, endpoint *Endpoint, methods []string, handler http.Handler, routes map[*mux.Route]*Endpoint) []*mux.Route {
+	added := dhs.newRoutes(router, endpoint, methods)
+	for _, route := range added {
+		if len(endpoint.Schemes) > 0 {
+			route.Schemes(endpoint.Schemes...)
+		}
+		route.Handler(handler)
+		routes[route] = endpoint
+	}
+	return added
+}
+
+// newRoutes adds one route matching methods and the matchers of endpoint but its
+// Schemes to router for every host and path combination of endpoint
+func (dhs *DynHttpSrv) newRoutes(router *mux.Router, endpoint *Endpoint, methods []string) []*mux.Route {
+	hosts := endpoint.Hosts
+	if hosts == nil {
+		hosts = []string{""}
+	}
+	paths := endpointPaths(endpoint)
+	if dhs.mergeSlashes && endpoint.Paths != nil {
+		paths = withSlashVariants(paths)
+	}
+	var routes []*mux.Route
+	for _, host := range hosts {
+		for _, path := range paths {
+			route := router.NewRoute()
+			if host != "" {
+				route.Host(host)
+			}
+			if endpoint.Paths == nil {
+				route.PathPrefix(endpointPrefix(endpoint) + "/")
+			} else {
+				route.Path(path)
+			}
+			if len(methods) > 0 {
+				route.Methods(methods...)
+			}
+			if len(endpoint.Headers) > 0 {
+				route.Headers(matcherPairs(endpoint.Headers)...)
+			}
+			if len(endpoint.Queries) > 0 {
+				route.Queries(matcherPairs(endpoint.Queries)...)
+			}
+			for _, matcher := range endpoint.Matchers {
+				route.MatcherFunc(matcher)
+			}
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// withSlashVariants returns paths along with each of them with its trailing slash
+// added or removed
+func withSlashVariants(paths []string) []string {
+	variants := make([]string, 0, 2*len(paths))
+	for _, path := range paths {
+		variants = append(variants, path)
+		switch {
+		case path == "/":
+		case strings.HasSuffix(path, "/"):
+			variants = append(variants, strings.TrimSuffix(path, "/"))
+		default:
+			variants = append(variants, path+"/")
+		}
+	}
+	return variants
+}
+
+// methodHandler is a handler of an endpoint along with the methods it serves, where
+// no methods means any method
+type methodHandler struct {
+	methods []string
+	handler http.HandlerFunc
+}
+
+// methodHandlers splits endpoint into one methodHandler per entry of Handlers, in
+// method order, followed by Handler serving the methods Handlers leaves out
+func methodHandlers(endpoint *Endpoint) []methodHandler {
+	listed := endpoint.Methods
+	if containsFold(listed, AllMethods) {
+		listed = nil
+	}
+	handler := http.HandlerFunc(endpoint.Handler)
+	if endpoint.HandlerObj != nil {
+		handler = endpoint.HandlerObj.ServeHTTP
+	}
+	if len(endpoint.Handlers) == 0 {
+		return []methodHandler{{methods: listed, handler: handler}}
+	}
+	methods := make([]string, 0, len(endpoint.Handlers))
+	for method := range endpoint.Handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	targets := make([]methodHandler, 0, len(methods)+1)
+	for _, method := range methods {
+		targets = append(targets, methodHandler{methods: []string{method}, handler: endpoint.Handlers[method]})
+	}
+	if handler == nil {
+		return targets
+	}
+	if len(listed) == 0 {
+		return append(targets, methodHandler{handler: handler})
+	}
+	remaining := make([]string, 0, len(listed))
+	for _, method := range listed {
+		if !containsFold(methods, method) {
+			remaining = append(remaining, method)
+		}
+	}
+	if len(remaining) > 0 {
+		targets = append(targets, methodHandler{methods: remaining, handler: handler})
+	}
+	return targets
+}
+
+// matcherPairs flattens matchers into the key/value pairs mux expects, sorted by
+// key so the resulting routes are deterministic
+func matcherPairs(matchers map[string]string) []string {
+	keys := make([]string, 0, len(matchers))
+	for key := range matchers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key, matchers[key])
+	}
+	return pairs
+}
+
+// limitConcurrency runs next while a slot is free, answering 503 otherwise
+func limitConcurrency(slots chan struct{}, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		defer func() { <-slots }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reportWriteError calls onError with the first error writing the response of a
+// request served by next returned, if any
+func reportWriteError(onError func(req *http.Request, err error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+		if rw.writeErr != nil {
+			onError(r, rw.writeErr)
+		}
+	})
+}
+
+// endpointHandler returns fn, one of the endpoint's handlers, wrapped in the
+// endpoint's own middleware and in the server's per-endpoint wrappers
+func (dhs *DynHttpSrv) endpointHandler(endpoint *Endpoint, fn http.HandlerFunc) http.Handler {
+	if endpoint.inflight == nil {
+		endpoint.inflight = newInflightCounter()
+	}
+	var handler http.Handler = fn
+	for i := len(endpoint.Middleware) - 1; i >= 0; i-- {
+		handler = endpoint.Middleware[i](handler)
+	}
+	if endpoint.group != nil {
+		for i := len(endpoint.group.middleware) - 1; i >= 0; i-- {
+			handler = endpoint.group.middleware[i](handler)
+		}
+	}
+	// Counted here as well since a timed out handler keeps running once
+	// TimeoutHandler answered
+	handler = endpoint.inflight.track(handler)
+	if endpoint.MaxConcurrent > 0 {
+		if cap(endpoint.slots) != endpoint.MaxConcurrent {
+			endpoint.slots = make(chan struct{}, endpoint.MaxConcurrent)
+		}
+		handler = limitConcurrency(endpoint.slots, handler)
+	}
+	timeout := endpoint.Timeout
+	if timeout == 0 {
+		timeout = dhs.requestTimeout
+	}
+	if timeout > 0 {
+		// The cause has to be set on the parent of the context TimeoutHandler
+		// derives, whose own deadline then never fires first
+		handler = http.TimeoutHandler(handler, timeout, http.StatusText(http.StatusServiceUnavailable))
+		handler = timeoutCause(timeout, handler)
+	}
+	if endpoint.Uploads != nil {
+		handler = limitUploads(*endpoint.Uploads, handler)
+	}
+	maxBodySize := endpoint.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = dhs.maxBodySize
+	}
+	if maxBodySize > 0 {
+		handler = limitBody(maxBodySize, handler)
+	}
+	if endpoint.ExpectContinueHandler != nil {
+		handler = expectContinue(endpoint.ExpectContinueHandler, handler)
+	}
+	for i := len(dhs.routeMiddleware) - 1; i >= 0; i-- {
+		handler = dhs.routeMiddleware[i](handler)
+	}
+	if dhs.recovery {
+		handler = dhs.recoverer(handler)
+	}
+	if endpoint.OnWriteError != nil {
+		handler = reportWriteError(endpoint.OnWriteError, handler)
+	}
+	handler = endpoint.inflight.track(handler)
+	if dhs.useEncodedPath {
+		handler = unescapeVars(handler)
 	}
-	dhs.Router.swap(newRouter)
+	return markRoute(endpoint, handler)
 }
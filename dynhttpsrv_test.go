@@ -0,0 +1,1328 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// newServer returns a silent in-memory server which is shut down when the test ends
+func newServer(t testing.TB, opts ...Option) *DynHttpSrv {
+	t.Helper()
+	dhs, _ := newServerClient(t, opts...)
+	return dhs
+}
+
+// newServerClient is like newServer and also returns a client reaching the server
+func newServerClient(t testing.TB, opts ...Option) (*DynHttpSrv, *http.Client) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, client := NewTestServer(ctx, append([]Option{WithLogger(nil)}, opts...)...)
+	t.Cleanup(func() {
+		cancel()
+		dhs.Wait()
+	})
+	return dhs, client
+}
+
+// text returns a handler answering body
+func text(body string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}
+}
+
+// do runs a request for method and target through dhs, with header holding
+// name/value pairs, and returns the response along with its body
+func do(t testing.TB, dhs *DynHttpSrv, method, target string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp := dhs.ServeRequest(req)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// expect fails the test unless a request for method and target gets status and,
+// if body is not empty, body
+func expect(t testing.TB, dhs *DynHttpSrv, method, target string, status int, body string) {
+	t.Helper()
+	resp, got := do(t, dhs, method, target)
+	if resp.StatusCode != status || body != "" && got != body {
+		t.Fatalf("%s %s: got %d %q, want %d %q", method, target, resp.StatusCode, got, status, body)
+	}
+}
+
+func TestConcurrentAddEndpoint(t *testing.T) {
+	dhs := newServer(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("/e%d", i)
+			if err := dhs.AddEndpoint(&Endpoint{Paths: []string{path}, Handler: text(path)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 50; i++ {
+		path := fmt.Sprintf("/e%d", i)
+		expect(t, dhs, "GET", path, http.StatusOK, path)
+	}
+}
+
+func TestConcurrentDelEndpoint(t *testing.T) {
+	dhs := newServer(t)
+	endpoints := make([]*Endpoint, 50)
+	for i := range endpoints {
+		endpoints[i] = &Endpoint{Paths: []string{fmt.Sprintf("/e%d", i)}, Handler: text("ok")}
+	}
+	if err := dhs.AddEndpoints(endpoints...); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for _, endpoint := range endpoints[:25] {
+		wg.Add(1)
+		go func(endpoint *Endpoint) {
+			defer wg.Done()
+			if err := dhs.DelEndpoint(endpoint); err != nil {
+				t.Error(err)
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+	for i := range endpoints {
+		status := http.StatusOK
+		if i < 25 {
+			status = http.StatusNotFound
+		}
+		expect(t, dhs, "GET", fmt.Sprintf("/e%d", i), status, "")
+	}
+}
+
+// startServer starts a silent server on a free local port, which is shut down when
+// the test ends
+func startServer(t testing.TB, opts ...Option) (*DynHttpSrv, string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, err := NewChecked(ctx, "127.0.0.1:0", append([]Option{WithLogger(nil)}, opts...)...)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		dhs.Wait()
+	})
+	addr, err := dhs.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dhs, "http://" + addr.String()
+}
+
+// get fetches url and returns the status and body of the response
+func get(t testing.TB, client *http.Client, url string) (int, string) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+// waitDone fails the test unless dhs stops within d
+func waitDone(t testing.TB, dhs *DynHttpSrv, d time.Duration) {
+	t.Helper()
+	select {
+	case <-dhs.Done():
+	case <-time.After(d):
+		t.Fatalf("server still running after %v", d)
+	}
+}
+
+func TestNewReportsListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	dhs := New(context.Background(), ln.Addr().String(), WithLogger(nil))
+	if err := dhs.ServerError(); err == nil {
+		t.Fatal("ServerError returned nil for an address already in use")
+	}
+	if _, err := dhs.Addr(); err == nil {
+		t.Fatal("Addr returned no error for an address already in use")
+	}
+}
+
+func TestReady(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dhs := New(ctx, "127.0.0.1:0", WithLogger(nil))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("up")})
+	select {
+	case <-dhs.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ready not closed")
+	}
+	addr, _ := dhs.Addr()
+	if status, body := get(t, http.DefaultClient, "http://"+addr.String()+"/"); status != http.StatusOK || body != "up" {
+		t.Fatalf("got %d %q", status, body)
+	}
+	cancel()
+	if err := dhs.ServerError(); err != nil {
+		t.Fatalf("clean shutdown reported %v", err)
+	}
+}
+
+func TestAddrOfPortZero(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, err := NewChecked(ctx, ":0", WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := dhs.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := addr.(*net.TCPAddr).Port
+	if port == 0 {
+		t.Fatal("Addr returned port 0")
+	}
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("ok")})
+	url := fmt.Sprintf("http://127.0.0.1:%d/", port)
+	if status, _ := get(t, http.DefaultClient, url); status != http.StatusOK {
+		t.Fatalf("got %d", status)
+	}
+	cancel()
+	dhs.Wait()
+	if conn, err := net.Dial("tcp", addr.String()); err == nil {
+		conn.Close()
+		t.Fatal("listener still open after shutdown")
+	}
+}
+
+func TestShutdownOnDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	dhs, _ := NewTestServer(ctx, WithLogger(nil))
+	waitDone(t, dhs, 2*time.Second)
+	if !errors.Is(dhs.StopCause(), context.DeadlineExceeded) {
+		t.Fatalf("StopCause is %v", dhs.StopCause())
+	}
+	if !dhs.IsShuttingDown() {
+		t.Fatal("IsShuttingDown is false after shutdown")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dhs, err := NewChecked(ctx, "127.0.0.1:0", WithLogger(nil), WithShutdownTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	hang := make(chan struct{})
+	defer close(hang)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/hang"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-hang
+	}})
+	addr, _ := dhs.Addr()
+	go http.Get("http://" + addr.String() + "/hang")
+	<-started
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+	if err := dhs.ServerError(); !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("ServerError is %v, want ErrShutdownTimeout", err)
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	dhs := newServer(t,
+		WithReadTimeout(1*time.Second),
+		WithWriteTimeout(2*time.Second),
+		WithIdleTimeout(3*time.Second),
+		WithMaxHeaderBytes(4096),
+		WithShutdownTimeout(5*time.Second),
+	)
+	srv := dhs.server
+	if srv.ReadTimeout != 1*time.Second || srv.WriteTimeout != 2*time.Second || srv.IdleTimeout != 3*time.Second {
+		t.Fatalf("timeouts are %v %v %v", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+	if srv.MaxHeaderBytes != 4096 {
+		t.Fatalf("MaxHeaderBytes is %d", srv.MaxHeaderBytes)
+	}
+	if dhs.shutdownTimeout != 5*time.Second {
+		t.Fatalf("shutdown timeout is %v", dhs.shutdownTimeout)
+	}
+}
+
+func TestUseRunsOncePerRequest(t *testing.T) {
+	dhs := newServer(t)
+	var count int
+	dhs.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			next.ServeHTTP(w, r)
+		})
+	})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/a"}, Handler: text("a")})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/b"}, Handler: text("b")})
+	expect(t, dhs, "GET", "/a", http.StatusOK, "a")
+	expect(t, dhs, "GET", "/b", http.StatusOK, "b")
+	expect(t, dhs, "GET", "/missing", http.StatusNotFound, "")
+	expect(t, dhs, "POST", "/b", http.StatusMethodNotAllowed, "")
+	if count != 4 {
+		t.Fatalf("middleware ran %d times for 4 requests", count)
+	}
+}
+
+// tag returns middleware appending letter to the X-Order header of responses, so
+// it shows the order in which middleware ran
+func tag(letter string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Order", letter)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestEndpointMiddleware(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/admin"}, Handler: text("admin"), Middleware: []Middleware{tag("a"), tag("b")}})
+	dhs.AddEndpoint(&Endpoint{Handler: text("any"), Middleware: []Middleware{tag("c")}})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/plain"}, Handler: text("plain")})
+	for _, tc := range []struct{ path, order string }{
+		{"/admin", "a,b"},
+		{"/elsewhere", "c"},
+		{"/plain", ""},
+	} {
+		resp, _ := do(t, dhs, "GET", tc.path)
+		if got := strings.Join(resp.Header.Values("X-Order"), ","); got != tc.order {
+			t.Errorf("%s: middleware order %q, want %q", tc.path, got, tc.order)
+		}
+	}
+}
+
+func TestUpdateEndpoint(t *testing.T) {
+	dhs := newServer(t)
+	var reloads int
+	dhs.OnReload(func([]*Endpoint) { reloads++ })
+	old := &Endpoint{Paths: []string{"/old"}, Handler: text("old")}
+	dhs.AddEndpoint(old)
+	reloads = 0
+	if err := dhs.UpdateEndpoint(old, &Endpoint{Paths: []string{"/new"}, Handler: text("new")}); err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 1 {
+		t.Fatalf("Update reloaded %d times", reloads)
+	}
+	expect(t, dhs, "GET", "/old", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/new", http.StatusOK, "new")
+	if err := dhs.UpdateEndpoint(old, &Endpoint{Paths: []string{"/x"}, Handler: text("x")}); err == nil {
+		t.Fatal("Update of an endpoint which is not registered succeeded")
+	}
+}
+
+func TestEndpointsAccessor(t *testing.T) {
+	dhs := newServer(t)
+	a := &Endpoint{Paths: []string{"/a"}, Handler: text("a")}
+	b := &Endpoint{Paths: []string{"/b"}, Handler: text("b")}
+	c := &Endpoint{Paths: []string{"/c"}, Handler: text("c")}
+	dhs.AddEndpoints(a, b, c)
+	dhs.DelEndpoint(b)
+	got := dhs.Endpoints()
+	if len(got) != 2 || got[0] != a || got[1] != c {
+		t.Fatalf("Endpoints returned %v", got)
+	}
+	got[0] = b
+	if dhs.Endpoints()[0] != a {
+		t.Fatal("changing the returned slice changed the registered endpoints")
+	}
+}
+
+func TestCustomErrorHandlersSurviveReloads(t *testing.T) {
+	dhs := newServer(t)
+	dhs.SetNotFoundHandler(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+	})
+	dhs.SetMethodNotAllowedHandler(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"method"}`, http.StatusMethodNotAllowed)
+	})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/a"}, Handler: text("a")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/b"}, Handler: text("b")})
+	expect(t, dhs, "GET", "/missing", http.StatusNotFound, "{\"error\":\"not found\"}\n")
+	expect(t, dhs, "POST", "/a", http.StatusMethodNotAllowed, "{\"error\":\"method\"}\n")
+}
+
+func TestPriority(t *testing.T) {
+	for _, highFirst := range []bool{true, false} {
+		dhs := newServer(t, WithAllowConflicts())
+		low := &Endpoint{Paths: []string{"/files/{rest:.*}"}, Handler: text("low")}
+		high := &Endpoint{Paths: []string{"/files/special"}, Priority: 10, Handler: text("high")}
+		if highFirst {
+			dhs.AddEndpoints(high, low)
+		} else {
+			dhs.AddEndpoints(low, high)
+		}
+		expect(t, dhs, "GET", "/files/special", http.StatusOK, "high")
+		expect(t, dhs, "GET", "/files/other", http.StatusOK, "low")
+	}
+}
+
+func TestOrderPreservedAcrossDel(t *testing.T) {
+	dhs := newServer(t, WithAllowConflicts())
+	a := &Endpoint{Paths: []string{"/x"}, Handler: text("a")}
+	b := &Endpoint{Paths: []string{"/y"}, Handler: text("b")}
+	c := &Endpoint{Paths: []string{"/x"}, Handler: text("c")}
+	d := &Endpoint{Paths: []string{"/x"}, Handler: text("d")}
+	dhs.AddEndpoints(a, b, c, d)
+	expect(t, dhs, "GET", "/x", http.StatusOK, "a")
+	dhs.DelEndpoint(b)
+	dhs.DelEndpoint(a)
+	expect(t, dhs, "GET", "/x", http.StatusOK, "c")
+	if got := dhs.Endpoints(); len(got) != 2 || got[0] != c || got[1] != d {
+		t.Fatalf("surviving endpoints reordered: %v", got)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Hosts: []string{"api.example.com"}, Paths: []string{"/"}, Handler: text("api")})
+	dhs.AddEndpoint(&Endpoint{Hosts: []string{"admin.example.com", "{sub}.admin.test"}, Paths: []string{"/"}, Handler: text("admin")})
+	for _, tc := range []struct{ host, body string }{
+		{"api.example.com", "api"},
+		{"admin.example.com", "admin"},
+		{"eu.admin.test", "admin"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = tc.host
+		resp := dhs.ServeRequest(req)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != tc.body {
+			t.Errorf("%s: got %d %q, want %q", tc.host, resp.StatusCode, body, tc.body)
+		}
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "other.example.com"
+	if resp := dhs.ServeRequest(req); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown host got %d", resp.StatusCode)
+	}
+}
+
+func TestHeadersAndQueries(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/items"}, Headers: map[string]string{"API-Version": "1"}, Handler: text("v1")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/items"}, Headers: map[string]string{"API-Version": "2"}, Handler: text("v2")})
+	dhs.AddEndpoint(&Endpoint{
+		Paths:   []string{"/search"},
+		Headers: map[string]string{"API-Version": "2"},
+		Queries: map[string]string{"q": "{q}"},
+		Handler: text("search"),
+	})
+	for _, tc := range []struct {
+		target, version string
+		status          int
+		body            string
+	}{
+		{"/items", "1", http.StatusOK, "v1"},
+		{"/items", "2", http.StatusOK, "v2"},
+		{"/items", "", http.StatusNotFound, ""},
+		{"/search?q=go", "2", http.StatusOK, "search"},
+		{"/search?q=go", "1", http.StatusNotFound, ""},
+		{"/search", "2", http.StatusNotFound, ""},
+	} {
+		resp, body := do(t, dhs, "GET", tc.target, "API-Version", tc.version)
+		if resp.StatusCode != tc.status || tc.body != "" && body != tc.body {
+			t.Errorf("%s with version %q: got %d %q", tc.target, tc.version, resp.StatusCode, body)
+		}
+	}
+}
+
+// benchEndpoints returns n endpoints with distinct paths
+func benchEndpoints(n int) []*Endpoint {
+	endpoints := make([]*Endpoint, n)
+	for i := range endpoints {
+		endpoints[i] = &Endpoint{Paths: []string{fmt.Sprintf("/bench/%d/{id}", i)}, Handler: text("ok")}
+	}
+	return endpoints
+}
+
+func BenchmarkAddEndpointSequential500(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		dhs := newServer(b)
+		for _, endpoint := range benchEndpoints(500) {
+			dhs.AddEndpoint(endpoint)
+		}
+	}
+}
+
+func BenchmarkAddEndpointsBatch500(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		dhs := newServer(b)
+		dhs.AddEndpoints(benchEndpoints(500)...)
+	}
+}
+
+func TestAddEndpointsIsTransactional(t *testing.T) {
+	dhs := newServer(t)
+	existing := &Endpoint{Paths: []string{"/taken"}, Handler: text("taken")}
+	dhs.AddEndpoint(existing)
+	err := dhs.AddEndpoints(
+		&Endpoint{Paths: []string{"/fresh"}, Handler: text("fresh")},
+		&Endpoint{Paths: []string{"/taken"}, Handler: text("duplicate")},
+	)
+	if err == nil {
+		t.Fatal("batch with a conflicting endpoint succeeded")
+	}
+	expect(t, dhs, "GET", "/fresh", http.StatusNotFound, "")
+	if err := dhs.AddEndpoints(existing); err == nil {
+		t.Fatal("re-adding a registered endpoint succeeded")
+	}
+	if err := dhs.SetEndpoints([]*Endpoint{{Paths: []string{"/only"}, Handler: text("only")}}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/taken", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/only", http.StatusOK, "only")
+}
+
+func TestTimeouts(t *testing.T) {
+	dhs := newServer(t, WithRequestTimeout(50*time.Millisecond))
+	cancelled := make(chan error, 1)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/slow"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		cancelled <- r.Context().Err()
+	}})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/fast"}, Handler: text("fast")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/own"}, Timeout: time.Second, Handler: func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "own")
+	}})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/stream"}, Timeout: -1, Handler: func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "stream")
+	}})
+	expect(t, dhs, "GET", "/slow", http.StatusServiceUnavailable, "")
+	if err := <-cancelled; err == nil {
+		t.Fatal("slow handler context not cancelled")
+	}
+	expect(t, dhs, "GET", "/fast", http.StatusOK, "fast")
+	expect(t, dhs, "GET", "/own", http.StatusOK, "own")
+	expect(t, dhs, "GET", "/stream", http.StatusOK, "stream")
+}
+
+func TestEmptyMethodsMatchEverything(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/nil"}, Handler: text("nil")})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{}, Paths: []string{"/empty"}, Handler: text("empty")})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"get"}, Paths: []string{"/lower"}, Handler: text("lower")})
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		expect(t, dhs, method, "/nil", http.StatusOK, "nil")
+		expect(t, dhs, method, "/empty", http.StatusOK, "empty")
+	}
+	expect(t, dhs, "GET", "/lower", http.StatusOK, "lower")
+	expect(t, dhs, "POST", "/lower", http.StatusMethodNotAllowed, "")
+}
+
+func TestNewCheckedReportsBindError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, err := NewChecked(ctx, "127.0.0.1:0", WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := first.Addr()
+	second, err := NewChecked(ctx, addr.String(), WithLogger(nil))
+	if err == nil {
+		t.Fatal("second NewChecked on the same port returned no error")
+	}
+	if second != nil {
+		t.Fatal("NewChecked returned a server along with its error")
+	}
+	cancel()
+	waitDone(t, first, 5*time.Second)
+}
+
+func TestWaitAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, client := NewTestServer(ctx, WithLogger(nil), WithShutdownTimeout(100*time.Millisecond))
+	started := make(chan struct{})
+	hang := make(chan struct{})
+	defer close(hang)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/hang"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-hang
+	}})
+	go client.Get("http://test/hang")
+	<-started
+	cancel()
+	waited := make(chan struct{})
+	go func() {
+		dhs.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after the shutdown timeout")
+	}
+	select {
+	case <-dhs.Done():
+	default:
+		t.Fatal("Done not closed once Wait returned")
+	}
+}
+
+func TestMethodHandlers(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{
+		Paths: []string{"/items"},
+		Handlers: map[string]http.HandlerFunc{
+			"GET":  text("list"),
+			"POST": text("create"),
+		},
+	})
+	dhs.AddEndpoint(&Endpoint{
+		Paths:    []string{"/mixed"},
+		Handler:  text("fallback"),
+		Handlers: map[string]http.HandlerFunc{"DELETE": text("delete")},
+	})
+	expect(t, dhs, "GET", "/items", http.StatusOK, "list")
+	expect(t, dhs, "POST", "/items", http.StatusOK, "create")
+	expect(t, dhs, "PUT", "/items", http.StatusMethodNotAllowed, "")
+	expect(t, dhs, "DELETE", "/mixed", http.StatusOK, "delete")
+	expect(t, dhs, "GET", "/mixed", http.StatusOK, "fallback")
+	expect(t, dhs, "PATCH", "/mixed", http.StatusOK, "fallback")
+}
+
+func BenchmarkServeParallel(b *testing.B) {
+	dhs := newServer(b)
+	dhs.AddEndpoints(benchEndpoints(100)...)
+	handler := dhs.server.Handler
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest("GET", "/bench/50/7", nil)
+		for pb.Next() {
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	})
+}
+
+func TestSwapWhileServing(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/stable"}, Handler: text("stable")})
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				resp := dhs.ServeRequest(httptest.NewRequest("GET", "/stable", nil))
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("got %d while swapping routers", resp.StatusCode)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		endpoint := &Endpoint{Paths: []string{fmt.Sprintf("/churn/%d", i)}, Handler: text("churn")}
+		dhs.AddEndpoint(endpoint)
+		dhs.DelEndpoint(endpoint)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestStrictSlash(t *testing.T) {
+	for _, strict := range []bool{true, false} {
+		dhs := newServer(t, WithStrictSlash(strict))
+		dhs.AddEndpoint(&Endpoint{Paths: []string{"/foo/"}, Handler: text("foo")})
+		expect(t, dhs, "GET", "/foo/", http.StatusOK, "foo")
+		resp, _ := do(t, dhs, "GET", "/foo")
+		if strict && (resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/foo/") {
+			t.Fatalf("strict: got %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+		}
+		if !strict && resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("not strict: got %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestMergeSlashes(t *testing.T) {
+	// WithMergeSlashes overrides WithStrictSlash, so nothing redirects
+	dhs := newServer(t, WithStrictSlash(true), WithMergeSlashes())
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"POST"}, Paths: []string{"/users"}, Handler: text("users")})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"POST"}, Paths: []string{"/teams/"}, Handler: text("teams")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("root")})
+	for _, tc := range []struct{ target, body string }{
+		{"/users", "users"},
+		{"/users/", "users"},
+		{"/teams", "teams"},
+		{"/teams/", "teams"},
+	} {
+		expect(t, dhs, "POST", tc.target, http.StatusOK, tc.body)
+	}
+	expect(t, dhs, "GET", "/", http.StatusOK, "root")
+}
+
+func TestIsShuttingDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, _ := NewTestServer(ctx, WithLogger(nil))
+	var order []string
+	dhs.OnShutdown(func() { order = append(order, "first") })
+	dhs.OnShutdown(func() {
+		if !dhs.IsShuttingDown() {
+			t.Error("IsShuttingDown false while shutdown hooks run")
+		}
+		order = append(order, "second")
+	})
+	if dhs.IsShuttingDown() {
+		t.Fatal("IsShuttingDown true before cancel")
+	}
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+	if !dhs.IsShuttingDown() {
+		t.Fatal("IsShuttingDown false after shutdown")
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Fatalf("hooks ran as %v", order)
+	}
+}
+
+func TestOnReload(t *testing.T) {
+	dhs := newServer(t)
+	var calls [][]*Endpoint
+	var order []int
+	dhs.OnReload(func(endpoints []*Endpoint) {
+		calls = append(calls, endpoints)
+		order = append(order, 1)
+	})
+	dhs.OnReload(func(endpoints []*Endpoint) {
+		// hooks run outside the lock so they can call back into the server
+		dhs.Endpoints()
+		order = append(order, 2)
+	})
+	a := &Endpoint{Paths: []string{"/a"}, Handler: text("a")}
+	b := &Endpoint{Paths: []string{"/b"}, Handler: text("b")}
+	b2 := &Endpoint{Paths: []string{"/b2"}, Handler: text("b2")}
+	dhs.AddEndpoint(a)
+	dhs.AddEndpoint(b)
+	dhs.UpdateEndpoint(b, b2)
+	dhs.DelEndpoint(a)
+	want := [][]*Endpoint{{a}, {a, b}, {a, b2}, {b2}}
+	if len(calls) != len(want) {
+		t.Fatalf("%d reload notifications, want %d", len(calls), len(want))
+	}
+	for i := range want {
+		if fmt.Sprint(calls[i]) != fmt.Sprint(want[i]) {
+			t.Fatalf("reload %d saw %v, want %v", i, calls[i], want[i])
+		}
+	}
+	if fmt.Sprint(order[:2]) != "[1 2]" {
+		t.Fatalf("hooks ran as %v", order)
+	}
+}
+
+func TestDelEndpointByPath(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/shared"}, Handler: text("get")})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"POST"}, Paths: []string{"/shared", "/other"}, Handler: text("post")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/kept"}, Handler: text("kept")})
+
+	if n, err := dhs.DelEndpointByMethodPath("POST", "/shared"); n != 1 || err != nil {
+		t.Fatalf("DelEndpointByMethodPath = %d, %v", n, err)
+	}
+	expect(t, dhs, "GET", "/shared", http.StatusOK, "get")
+	expect(t, dhs, "POST", "/other", http.StatusNotFound, "")
+
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"POST"}, Paths: []string{"/shared"}, Handler: text("post")})
+	if n, err := dhs.DelEndpointByPath("/shared"); n != 2 || err != nil {
+		t.Fatalf("DelEndpointByPath = %d, %v", n, err)
+	}
+	expect(t, dhs, "GET", "/shared", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/kept", http.StatusOK, "kept")
+
+	if n, err := dhs.DelEndpointByPath("/missing"); n != 0 || err == nil {
+		t.Fatalf("DelEndpointByPath of a missing path = %d, %v", n, err)
+	}
+	if n, err := dhs.DelEndpointByMethodPath("DELETE", "/kept/x"); n != 0 || err == nil {
+		t.Fatalf("DelEndpointByMethodPath of a missing path = %d, %v", n, err)
+	}
+}
+
+// failingReloads returns an option whose route middleware panics while the router
+// is built once *fail is set, making every reload fail
+func failingReloads(fail *bool) Option {
+	return WithRouteMiddleware(func(next http.Handler) http.Handler {
+		if *fail {
+			panic("building the route failed")
+		}
+		return next
+	})
+}
+
+func TestReloadErrorsArePropagated(t *testing.T) {
+	fail := false
+	dhs := newServer(t, failingReloads(&fail))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/a"}, Handler: text("a")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/b"}, Handler: text("b")})
+	group := dhs.Group("/g")
+	group.AddEndpoint(&Endpoint{Paths: []string{"/c"}, Handler: text("c")})
+	fail = true
+
+	if n, err := dhs.DelEndpointByPath("/a"); n != 0 || err == nil {
+		t.Fatalf("DelEndpointByPath = %d, %v", n, err)
+	}
+	if n, err := dhs.DelEndpointByMethodPath("GET", "/a"); n != 0 || err == nil {
+		t.Fatalf("DelEndpointByMethodPath = %d, %v", n, err)
+	}
+	if n, err := group.Delete(); n != 0 || err == nil {
+		t.Fatalf("Group.Delete = %d, %v", n, err)
+	}
+	if len(dhs.Endpoints()) != 3 {
+		t.Fatalf("%d endpoints left after failed deletes", len(dhs.Endpoints()))
+	}
+	expect(t, dhs, "GET", "/a", http.StatusOK, "a")
+	expect(t, dhs, "GET", "/g/c", http.StatusOK, "c")
+
+	other := func(w http.ResponseWriter, r *http.Request) {}
+	if err := dhs.SetNotFoundHandler(other); err == nil {
+		t.Fatal("SetNotFoundHandler returned no error")
+	}
+	if err := dhs.SetMethodNotAllowedHandler(other); err == nil {
+		t.Fatal("SetMethodNotAllowedHandler returned no error")
+	}
+	if err := dhs.SetFallback(other); err == nil {
+		t.Fatal("SetFallback returned no error")
+	}
+	if dhs.notFoundHandler != nil || dhs.methodNotAllowedHandler != nil || dhs.fallback != nil {
+		t.Fatal("failed setters kept their handlers")
+	}
+	if err := dhs.Use(tag("x")); err == nil {
+		t.Fatal("Use returned no error")
+	}
+	fail = false
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/d"}, Handler: text("d")})
+	if resp, _ := do(t, dhs, "GET", "/a"); resp.Header.Get("X-Order") != "" {
+		t.Fatal("middleware kept after a failed Use")
+	}
+}
+
+func TestRemoveAllEndpoints(t *testing.T) {
+	dhs := newServer(t, WithStrictSlash(false))
+	dhs.SetNotFoundHandler(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "custom 404", http.StatusNotFound)
+	})
+	paths := []string{"/a", "/b/{id}", "/c/"}
+	for _, path := range paths {
+		dhs.AddEndpoint(&Endpoint{Paths: []string{path}, Handler: text("found")})
+	}
+	dhs.AddEndpoint(&Endpoint{Handler: text("catch-all")})
+	if err := dhs.RemoveAllEndpoints(); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"/a", "/b/1", "/c/", "/c", "/anything"} {
+		expect(t, dhs, "GET", target, http.StatusNotFound, "custom 404\n")
+		if _, _, ok := dhs.Match("GET", target); ok {
+			t.Fatalf("Match(%q) found an endpoint after RemoveAllEndpoints", target)
+		}
+	}
+	if len(dhs.Endpoints()) != 0 {
+		t.Fatalf("%d endpoints left", len(dhs.Endpoints()))
+	}
+}
+
+func TestRemoveAllEndpointsReportsReloadError(t *testing.T) {
+	fail := false
+	dhs := newServer(t, failingReloads(&fail))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/a"}, Handler: text("a")})
+	dhs.SetFallback(text("fallback"))
+	fail = true
+	if err := dhs.RemoveAllEndpoints(); err == nil {
+		t.Fatal("RemoveAllEndpoints returned no error")
+	}
+	expect(t, dhs, "GET", "/a", http.StatusOK, "a")
+	if len(dhs.Endpoints()) != 1 {
+		t.Fatalf("%d endpoints after a failed RemoveAllEndpoints", len(dhs.Endpoints()))
+	}
+}
+
+func TestLifecycleLogging(t *testing.T) {
+	logs := &recordHandler{}
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, _ := NewTestServer(ctx, WithLogger(slog.New(logs)))
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(logs.attrs("ListenAndServe exited")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for _, msg := range []string{"Shutting down", "Shutdown finished", "ListenAndServe exited"} {
+		if len(logs.attrs(msg)) != 1 {
+			t.Errorf("%q logged %d times", msg, len(logs.attrs(msg)))
+		}
+	}
+
+	logs = &recordHandler{}
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	New(context.Background(), ln.Addr().String(), WithLogger(slog.New(logs))).Wait()
+	if len(logs.attrs("Listen ended with error")) != 1 {
+		t.Error("listen failure not logged through the configured logger")
+	}
+}
+
+func TestFallback(t *testing.T) {
+	dhs := newServer(t)
+	dhs.SetFallback(text("fallback"))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/a"}, Handler: text("a")})
+	// registered later and at a lower priority, the fallback still comes last
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/low"}, Priority: -10, Handler: text("low")})
+	expect(t, dhs, "GET", "/a", http.StatusOK, "a")
+	expect(t, dhs, "GET", "/low", http.StatusOK, "low")
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		expect(t, dhs, method, "/b", http.StatusOK, "fallback")
+	}
+	dhs.SetFallback(nil)
+	expect(t, dhs, "GET", "/b", http.StatusNotFound, "")
+}
+
+func TestStopCause(t *testing.T) {
+	errReason := errors.New("config reloaded")
+	logs := &recordHandler{}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	dhs, client := NewTestServer(ctx, WithLogger(slog.New(logs)), WithShutdownTimeout(50*time.Millisecond))
+	started := make(chan struct{})
+	hang := make(chan struct{})
+	defer close(hang)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/hang"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-hang
+	}})
+	go client.Get("http://test/hang")
+	<-started
+	cancel(errReason)
+	waitDone(t, dhs, 5*time.Second)
+	if !errors.Is(dhs.StopCause(), errReason) {
+		t.Fatalf("StopCause is %v", dhs.StopCause())
+	}
+	if err := dhs.ServerError(); !errors.Is(err, errReason) || !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("ServerError is %v", err)
+	}
+	lines := logs.attrs("Shutting down")
+	if len(lines) != 1 || lines[0]["cause"].String() != errReason.Error() {
+		t.Fatalf("shutdown log lines %v", lines)
+	}
+}
+
+func TestAutomaticHead(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/doc"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Doc", "yes")
+		io.WriteString(w, "<html>document</html>")
+	}})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{AllMethods}, Paths: []string{"/any"}, Handler: text("any")})
+	resp, body := do(t, dhs, "HEAD", "/doc")
+	if resp.StatusCode != http.StatusOK || body != "" || resp.Header.Get("X-Doc") != "yes" {
+		t.Fatalf("HEAD got %d %q, X-Doc %q", resp.StatusCode, body, resp.Header.Get("X-Doc"))
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Fatalf("HEAD Content-Type %q", got)
+	}
+	for _, method := range []string{"GET", "PROPFIND", "PATCH"} {
+		expect(t, dhs, method, "/any", http.StatusOK, "any")
+	}
+
+	strict := newServer(t, WithStrictMethods())
+	strict.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/doc"}, Handler: text("doc")})
+	expect(t, strict, "HEAD", "/doc", http.StatusMethodNotAllowed, "")
+}
+
+func TestNoGoroutineLeak(t *testing.T) {
+	settle := func() int {
+		n := runtime.NumGoroutine()
+		for i := 0; i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+			m := runtime.NumGoroutine()
+			if m == n {
+				return n
+			}
+			n = m
+		}
+		return n
+	}
+	before := settle()
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		dhs, _ := NewTestServer(ctx, WithLogger(nil))
+		dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("ok")})
+		cancel()
+		dhs.Wait()
+
+		// a server which never binds has nobody to cancel it
+		New(context.Background(), busy.Addr().String(), WithLogger(nil)).Wait()
+	}
+	if after := settle(); after > before+2 {
+		t.Fatalf("%d goroutines before, %d after", before, after)
+	}
+}
+
+func TestReloadDebounce(t *testing.T) {
+	dhs := newServer(t, WithReloadDebounce(time.Hour))
+	var reloads atomic.Int32
+	dhs.OnReload(func([]*Endpoint) { reloads.Add(1) })
+	for i := 0; i < 10; i++ {
+		dhs.AddEndpoint(&Endpoint{Paths: []string{fmt.Sprintf("/e/%d", i)}, Handler: text("e")})
+	}
+	expect(t, dhs, "GET", "/e/0", http.StatusNotFound, "")
+	if err := dhs.FlushReload(); err != nil {
+		t.Fatal(err)
+	}
+	if n := reloads.Load(); n != 1 {
+		t.Fatalf("%d router swaps for ten adds", n)
+	}
+	expect(t, dhs, "GET", "/e/9", http.StatusOK, "e")
+	if err := dhs.FlushReload(); err != nil || reloads.Load() != 1 {
+		t.Fatalf("FlushReload with nothing pending reloaded: %v", err)
+	}
+
+	settled := newServer(t, WithReloadDebounce(20*time.Millisecond))
+	swapped := make(chan struct{}, 10)
+	settled.OnReload(func([]*Endpoint) { swapped <- struct{}{} })
+	for i := 0; i < 10; i++ {
+		settled.AddEndpoint(&Endpoint{Paths: []string{fmt.Sprintf("/e/%d", i)}, Handler: text("e")})
+	}
+	select {
+	case <-swapped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("debounced reload never happened")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(swapped) != 0 {
+		t.Fatalf("%d extra router swaps", len(swapped))
+	}
+	expect(t, settled, "GET", "/e/9", http.StatusOK, "e")
+}
+
+func TestMatchers(t *testing.T) {
+	dhs := newServer(t)
+	hasToken := func(r *http.Request, _ *mux.RouteMatch) bool {
+		return r.URL.Query().Has("token")
+	}
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/gated"}, Matchers: []mux.MatcherFunc{hasToken}, Handler: text("gated")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/gated"}, Priority: -1, Handler: text("open")})
+	expect(t, dhs, "GET", "/gated?token=x", http.StatusOK, "gated")
+	expect(t, dhs, "GET", "/gated?token=", http.StatusOK, "gated")
+	expect(t, dhs, "GET", "/gated", http.StatusOK, "open")
+}
+
+func TestAutoOptions(t *testing.T) {
+	dhs := newServer(t, WithAutoOptions())
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/items"}, Handler: text("list")})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"POST"}, Paths: []string{"/items"}, Handler: text("create")})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"OPTIONS"}, Paths: []string{"/own"}, Handler: text("own options")})
+	resp, body := do(t, dhs, "OPTIONS", "/items")
+	if resp.StatusCode != http.StatusNoContent || body != "" {
+		t.Fatalf("got %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Allow"); got != "GET, POST, OPTIONS" {
+		t.Fatalf("Allow %q", got)
+	}
+	expect(t, dhs, "OPTIONS", "/own", http.StatusOK, "own options")
+	expect(t, dhs, "OPTIONS", "/missing", http.StatusNotFound, "")
+}
+
+func TestCatchAllRegisteredLast(t *testing.T) {
+	logs := &recordHandler{}
+	dhs := newServer(t, WithLogger(slog.New(logs)), WithAllowConflicts())
+	dhs.AddEndpoint(&Endpoint{Handler: text("catch-all")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/health"}, Handler: text("healthy")})
+	expect(t, dhs, "GET", "/health", http.StatusOK, "healthy")
+	expect(t, dhs, "GET", "/other", http.StatusOK, "catch-all")
+	if len(logs.attrs("Multiple catch-all endpoints registered")) != 0 {
+		t.Fatal("warned about a single catch-all")
+	}
+	if err := dhs.AddEndpoint(&Endpoint{Handler: text("second catch-all")}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/other", http.StatusOK, "catch-all")
+	if len(logs.attrs("Multiple catch-all endpoints registered")) == 0 {
+		t.Fatal("no warning for two catch-alls")
+	}
+}
+
+func TestFailedReloadKeepsRouter(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/ok"}, Handler: text("ok")})
+	before := dhs.Router.state()
+	broken := &Endpoint{Paths: []string{"/broken"}, Handler: text("broken"), Middleware: []Middleware{
+		func(http.Handler) http.Handler { panic("cannot register") },
+	}}
+	if err := dhs.AddEndpoint(broken); err == nil || !strings.Contains(err.Error(), "cannot register") {
+		t.Fatalf("AddEndpoint = %v", err)
+	}
+	if dhs.Router.state() != before {
+		t.Fatal("router swapped after a failed build")
+	}
+	if endpoints := dhs.Endpoints(); len(endpoints) != 1 || endpoints[0].Paths[0] != "/ok" {
+		t.Fatalf("endpoints %v after a failed add", endpoints)
+	}
+	expect(t, dhs, "GET", "/ok", http.StatusOK, "ok")
+	expect(t, dhs, "GET", "/broken", http.StatusNotFound, "")
+	// the server keeps working
+	if err := dhs.AddEndpoint(&Endpoint{Paths: []string{"/next"}, Handler: text("next")}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/next", http.StatusOK, "next")
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	dhs := newServer(t)
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/report"}, MaxConcurrent: 2, Handler: func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/free"}, Handler: text("free")})
+	statuses := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			statuses <- dhs.ServeRequest(httptest.NewRequest("GET", "/report", nil)).StatusCode
+		}()
+	}
+	<-started
+	<-started
+	for i := 0; i < 3; i++ {
+		resp, _ := do(t, dhs, "GET", "/report")
+		if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+			t.Fatalf("saturated endpoint got %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+	expect(t, dhs, "GET", "/free", http.StatusOK, "free")
+	close(release)
+	for i := 0; i < 2; i++ {
+		if status := <-statuses; status != http.StatusOK {
+			t.Fatalf("admitted request got %d", status)
+		}
+	}
+	// the slots are free again
+	if resp, _ := do(t, dhs, "GET", "/report"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("request after the burst got %d", resp.StatusCode)
+	}
+}
+
+func TestCancellationCauses(t *testing.T) {
+	dhs := newServer(t)
+	causes := make(chan error, 1)
+	started := make(chan struct{}, 1)
+	wait := func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+		causes <- context.Cause(r.Context())
+	}
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/wait"}, Handler: wait})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/slow"}, Timeout: 20 * time.Millisecond, Handler: wait})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go dhs.ServeRequest(httptest.NewRequest("GET", "/wait", nil).WithContext(ctx))
+	<-started
+	cancel()
+	if cause := <-causes; !errors.Is(cause, ErrClientClosed) {
+		t.Fatalf("client going away: cause %v, want ErrClientClosed", cause)
+	}
+
+	resp, _ := do(t, dhs, "GET", "/slow")
+	<-started
+	if cause := <-causes; !errors.Is(cause, ErrServerTimeout) {
+		t.Fatalf("timeout elapsing: cause %v, want ErrServerTimeout", cause)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("timed out request got %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	// the handler reports the X-Order header as it stood when it ran
+	seen := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Join(w.Header().Values("X-Order"), ","))
+	}
+	for _, tc := range []struct {
+		name             string
+		global, endpoint []Middleware
+		want             string
+	}{
+		{"global only", []Middleware{tag("a"), tag("b")}, nil, "a,b"},
+		{"endpoint only", nil, []Middleware{tag("c"), tag("d")}, "c,d"},
+		{"combined", []Middleware{tag("a"), tag("b")}, []Middleware{tag("c"), tag("d")}, "a,b,c,d"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dhs := newServer(t)
+			for _, mw := range tc.global {
+				dhs.Use(mw)
+			}
+			dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: seen, Middleware: tc.endpoint})
+			expect(t, dhs, "GET", "/", http.StatusOK, tc.want)
+		})
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	dhs := newServer(t, WithPathPrefix("/svc-a/"))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/users"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("root")})
+	expect(t, dhs, "GET", "/svc-a/users", http.StatusOK, "/users")
+	expect(t, dhs, "GET", "/svc-a", http.StatusOK, "root")
+	expect(t, dhs, "GET", "/svc-a/", http.StatusOK, "root")
+	for _, target := range []string{"/users", "/svc-ab/users", "/other/svc-a/users"} {
+		expect(t, dhs, "GET", target, http.StatusNotFound, "")
+	}
+}
+
+func TestPathPrefixRedirects(t *testing.T) {
+	dhs := newServer(t, WithPathPrefix("/svc"), WithSchemeRedirect())
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/users/"}, Handler: text("users")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/sec"}, Schemes: []string{"https"}, Handler: text("secure")})
+	dhs.AddRedirect("/old", "/users/", http.StatusFound)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/away"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://other.example/x", http.StatusFound)
+	}})
+	dhs.AddEndpoint(&Endpoint{Name: "users", Paths: []string{"/list"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		u, _ := dhs.URL("users")
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	}})
+	for _, tc := range []struct{ target, location string }{
+		{"http://h/svc/users", "http://h/svc/users/"},
+		{"http://h/svc/sec?tab=1", "https://h/svc/sec?tab=1"},
+		{"http://h/svc/old", "/svc/users/"},
+		{"http://h/svc/away", "https://other.example/x"},
+		// already under the prefix
+		{"http://h/svc/list", "/svc/list"},
+	} {
+		resp, _ := do(t, dhs, "GET", tc.target)
+		location := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode > 399 || location != tc.location {
+			t.Errorf("%s: got %d to %q, want %q", tc.target, resp.StatusCode, location, tc.location)
+		}
+	}
+}
+
+func TestSetEndpointEnabled(t *testing.T) {
+	dhs := newServer(t)
+	reloads := 0
+	dhs.OnReload(func([]*Endpoint) { reloads++ })
+	flag := &Endpoint{Name: "beta", Paths: []string{"/beta"}, Priority: 5, Handler: text("beta")}
+	dhs.AddEndpoint(flag)
+	dhs.AddEndpoint(&Endpoint{Handler: text("fallback")})
+	reloads = 0
+
+	if err := dhs.SetEndpointEnabled(flag, false); err != nil {
+		t.Fatal(err)
+	}
+	// its requests go on to the other routes
+	expect(t, dhs, "GET", "/beta", http.StatusOK, "fallback")
+	if endpoints := dhs.Endpoints(); len(endpoints) != 2 || endpoints[0] != flag || flag.Name != "beta" || flag.Priority != 5 {
+		t.Fatalf("disabled endpoint no longer registered as it was: %v", endpoints)
+	}
+	dhs.SetEndpointEnabled(flag, false)
+	if err := dhs.SetEndpointEnabled(flag, true); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/beta", http.StatusOK, "beta")
+	if reloads != 2 {
+		t.Fatalf("%d reloads for two toggles", reloads)
+	}
+	if err := dhs.SetEndpointEnabled(&Endpoint{}, true); err == nil {
+		t.Fatal("SetEndpointEnabled accepted an endpoint never added")
+	}
+}
+
+func TestDisabledEndpointNotFound(t *testing.T) {
+	dhs := newServer(t)
+	endpoint := &Endpoint{Paths: []string{"/beta"}, Disabled: true, Handler: text("beta")}
+	dhs.AddEndpoint(endpoint)
+	expect(t, dhs, "GET", "/beta", http.StatusNotFound, "")
+	dhs.SetEndpointEnabled(endpoint, true)
+	expect(t, dhs, "GET", "/beta", http.StatusOK, "beta")
+}
+
+func TestAutomaticHeadBeforeCatchAll(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/a"}, Handler: tag("a")(http.HandlerFunc(text("a"))).ServeHTTP})
+	// the catch-all serves every method, HEAD included
+	dhs.AddEndpoint(&Endpoint{Handler: tag("catch-all")(http.HandlerFunc(text("any"))).ServeHTTP})
+	for _, tc := range []struct{ target, order string }{
+		{"/a", "a"},
+		{"/elsewhere", "catch-all"},
+	} {
+		resp, _ := do(t, dhs, "HEAD", tc.target)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Order") != tc.order {
+			t.Errorf("HEAD %s: got %d from %q, want %q", tc.target, resp.StatusCode, resp.Header.Get("X-Order"), tc.order)
+		}
+	}
+	if _, body := do(t, dhs, "HEAD", "/a"); body != "" {
+		t.Errorf("automatic HEAD sent body %q", body)
+	}
+}
+
+func TestAutomaticHeadFlushes(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/stream"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("chunk"))
+		flusher.Flush()
+	}})
+	resp, body := do(t, dhs, "HEAD", "/stream")
+	if resp.StatusCode != http.StatusOK || body != "" {
+		t.Fatalf("HEAD of a streaming endpoint got %d %q", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,43 @@
+// Package dynhttpsrvotel adds OpenTelemetry tracing to dynhttpsrv servers, keeping the
+// otel dependency out of the core package
+package dynhttpsrvotel
+
+import (
+	"net/http"
+
+	"github.com/adi/dynhttpsrv"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/adi/dynhttpsrv/dynhttpsrvotel"
+
+// WithTracing starts a server span for every request matching an endpoint, named
+// after the matched route template and continuing the trace propagated in the
+// request headers. The span context is passed on through the request context.
+func WithTracing(tp trace.TracerProvider) dynhttpsrv.Option {
+	tracer := tp.Tracer(instrumentationName)
+	return dynhttpsrv.WithRouteMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			name := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					name = template
+				}
+			}
+			ctx, span := tracer.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", name),
+				),
+			)
+			defer span.End()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
@@ -0,0 +1,54 @@
+package dynhttpsrvotel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adi/dynhttpsrv"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dhs, _ := dynhttpsrv.NewTestServer(ctx, dynhttpsrv.WithLogger(nil), WithTracing(tp))
+	var handlerSpan trace.SpanContext
+	dhs.AddEndpoint(&dynhttpsrv.Endpoint{Paths: []string{"/users/{id}"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		io.WriteString(w, "ok")
+	}})
+
+	dhs.ServeRequest(httptest.NewRequest("GET", "/users/1", nil))
+	req := httptest.NewRequest("GET", "/users/2", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	dhs.ServeRequest(req)
+	dhs.ServeRequest(httptest.NewRequest("GET", "/missing", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans for 2 matched requests", len(spans))
+	}
+	for _, span := range spans {
+		if span.Name != "/users/{id}" || span.SpanKind != trace.SpanKindServer {
+			t.Fatalf("span %q of kind %v", span.Name, span.SpanKind)
+		}
+	}
+	if got := spans[1].SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("incoming trace not continued, trace ID %s", got)
+	}
+	if !handlerSpan.Equal(spans[1].SpanContext) {
+		t.Fatal("handler context does not carry the request span")
+	}
+}
@@ -0,0 +1,65 @@
+package dynhttpsrv
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// EndpointID identifies an endpoint once it was added to a server. IDs are never
+// reused, even after the endpoint is deleted, and survive router reloads.
+type EndpointID uint64
+
+// lastEndpointID is the ID most recently given to an endpoint by any server
+var lastEndpointID atomic.Uint64
+
+// ID returns the ID of the endpoint, or 0 if it was never added to a server
+func (endpoint *Endpoint) ID() EndpointID {
+	return endpoint.id
+}
+
+// GetEndpointByID returns the registered endpoint with ID id, if any
+func (dhs *DynHttpSrv) GetEndpointByID(id EndpointID) (*Endpoint, bool) {
+	dhs.mu.Lock()
+	defer dhs.mu.Unlock()
+	endpoint := dhs.endpointByID(id)
+	return endpoint, endpoint != nil
+}
+
+// DelEndpointByID removes the endpoint with ID id like DelEndpoint
+func (dhs *DynHttpSrv) DelEndpointByID(id EndpointID) error {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	pos := dhs.indexOf(dhs.endpointByID(id))
+	if pos == -1 {
+		return errors.New("endpoint not found")
+	}
+	dhs.endpoints = append(dhs.endpoints[0:pos], dhs.endpoints[pos+1:]...)
+	return dhs.reloadEndpoints()
+}
+
+// endpointByID returns the registered endpoint with ID id, or nil. Callers must hold
+// dhs.mu.
+func (dhs *DynHttpSrv) endpointByID(id EndpointID) *Endpoint {
+	if id == 0 {
+		return nil
+	}
+	for _, endpoint := range dhs.endpoints {
+		if endpoint.id == id {
+			return endpoint
+		}
+	}
+	return nil
+}
+
+// assignIDs gives a fresh ID to the registered endpoints which have none, or share
+// the one of an earlier endpoint because they were copied from it. Callers must
+// hold dhs.mu.
+func (dhs *DynHttpSrv) assignIDs() {
+	seen := make(map[EndpointID]bool, len(dhs.endpoints))
+	for _, endpoint := range dhs.endpoints {
+		if endpoint.id == 0 || seen[endpoint.id] {
+			endpoint.id = EndpointID(lastEndpointID.Add(1))
+		}
+		seen[endpoint.id] = true
+	}
+}
@@ -0,0 +1,42 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEndpointIDs(t *testing.T) {
+	dhs := newServer(t)
+	a := &Endpoint{Paths: []string{"/a"}, Handler: text("a")}
+	b := &Endpoint{Paths: []string{"/b"}, Handler: text("b")}
+	dhs.AddEndpoints(a, b)
+	idA, idB := a.ID(), b.ID()
+	if idA == 0 || idB == 0 || idA == idB {
+		t.Fatalf("IDs %d and %d", idA, idB)
+	}
+	if err := dhs.DelEndpointByID(idA); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/a", http.StatusNotFound, "")
+	if _, ok := dhs.GetEndpointByID(idA); ok {
+		t.Fatal("deleted endpoint still found by its ID")
+	}
+	if err := dhs.DelEndpointByID(idA); err == nil {
+		t.Fatal("DelEndpointByID deleted an endpoint twice")
+	}
+
+	// reloads keep IDs, and copies get their own
+	copied := *b
+	copied.Paths = []string{"/b2"}
+	dhs.AddEndpoint(&copied)
+	if endpoint, ok := dhs.GetEndpointByID(idB); !ok || endpoint != b || b.ID() != idB {
+		t.Fatalf("GetEndpointByID(%d) = %v, %v", idB, endpoint, ok)
+	}
+	if id := copied.ID(); id == idB || id == idA {
+		t.Fatalf("copied endpoint got ID %d", id)
+	}
+	expect(t, dhs, "GET", "/b", http.StatusOK, "b")
+	if _, ok := dhs.GetEndpointByID(0); ok {
+		t.Fatal("an endpoint was found by ID 0")
+	}
+}
@@ -0,0 +1,190 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etagMaxSize is the largest response WithETag buffers to hash, larger ones are
+// passed through without an ETag
+const etagMaxSize = 1 << 20
+
+// WithETag returns middleware setting a weak ETag hashed from the body of successful
+// GET and HEAD responses and answering 304 Not Modified when it matches the request's
+// If-None-Match. Responses which are flushed, hijacked, larger than 1MiB or already
+// carry an ETag are passed through untouched. Pass it to Use or to
+// Endpoint.Middleware. Automatic HEAD responses get the ETag of the GET body either
+// way, while endpoints serving HEAD themselves get the one of what they write.
+func WithETag() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ew := &etagWriter{ResponseWriter: w, ifNoneMatch: r.Header.Get("If-None-Match")}
+			if r.Method == http.MethodHead {
+				// The automatic HEAD route then leaves the GET body to ew, which
+				// hashes it and discards it itself
+				ew.head = true
+				r = r.WithContext(context.WithValue(r.Context(), keepHeadBodyKey{}, true))
+			}
+			next.ServeHTTP(ew, r)
+			ew.finish()
+		})
+	}
+}
+
+// etagWriter buffers a response until it is complete so its ETag can be computed,
+// switching to passing everything through once it turns out to be streamed or too
+// large
+type etagWriter struct {
+	http.ResponseWriter
+	ifNoneMatch string
+	// head is set for HEAD requests, whose body is hashed but never sent
+	head bool
+
+	status      int
+	buf         []byte
+	passthrough bool
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if ew.passthrough {
+		ew.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if ew.status != 0 {
+		return
+	}
+	if status < http.StatusOK && status != http.StatusSwitchingProtocols {
+		ew.ResponseWriter.WriteHeader(status)
+		return
+	}
+	ew.status = status
+	if status != http.StatusOK || ew.Header().Get("ETag") != "" ||
+		strings.HasPrefix(ew.Header().Get("Content-Type"), "text/event-stream") {
+		ew.passThrough()
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if ew.status == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.passthrough {
+		return ew.forward(b)
+	}
+	if len(ew.buf)+len(b) > etagMaxSize {
+		if err := ew.passThrough(); err != nil {
+			return 0, err
+		}
+		return ew.forward(b)
+	}
+	ew.buf = append(ew.buf, b...)
+	return len(b), nil
+}
+
+// passThrough sends the header and anything buffered so far, and stops buffering
+func (ew *etagWriter) passThrough() error {
+	ew.passthrough = true
+	if ew.status == 0 {
+		return nil
+	}
+	buf := ew.buf
+	ew.buf = nil
+	if ew.head && len(buf) > 0 {
+		headWriter{ew.ResponseWriter}.Write(buf)
+	}
+	ew.ResponseWriter.WriteHeader(ew.status)
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := ew.forward(buf)
+	return err
+}
+
+// forward writes b on, unless it is the body of a HEAD response
+func (ew *etagWriter) forward(b []byte) (int, error) {
+	if ew.head {
+		return headWriter{ew.ResponseWriter}.Write(b)
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+// finish sends the buffered response with its ETag, or a bodiless 304 if the client
+// already has it
+func (ew *etagWriter) finish() {
+	if ew.passthrough || ew.status == 0 {
+		return
+	}
+	sum := sha256.Sum256(ew.buf)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	header := ew.Header()
+	header.Set("ETag", etag)
+	if etagMatches(ew.ifNoneMatch, etag) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if header.Get("Content-Length") == "" {
+		header.Set("Content-Length", strconv.Itoa(len(ew.buf)))
+	}
+	// Sniffed here as the header is sent before the body, which HEAD discards
+	if _, ok := header["Content-Type"]; !ok && len(ew.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(ew.buf))
+	}
+	ew.ResponseWriter.WriteHeader(ew.status)
+	ew.forward(ew.buf)
+}
+
+// Flush marks the response as streamed, sending it on without an ETag
+func (ew *etagWriter) Flush() {
+	if !ew.passthrough {
+		if ew.status == 0 {
+			ew.status = http.StatusOK
+		}
+		ew.passThrough()
+	}
+	if flusher, ok := ew.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (ew *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := ew.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	ew.passthrough = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the weak
+// comparison RFC 9110 prescribes for it
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
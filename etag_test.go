@@ -0,0 +1,91 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/doc"}, Middleware: []Middleware{WithETag()}, Handler: text("document")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/stream"}, Middleware: []Middleware{WithETag()}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("part"))
+		w.(http.Flusher).Flush()
+	}})
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"POST"}, Paths: []string{"/doc"}, Middleware: []Middleware{WithETag()}, Handler: text("posted")})
+
+	resp, body := do(t, dhs, "GET", "/doc")
+	etag := resp.Header.Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) || body != "document" {
+		t.Fatalf("ETag %q, body %q", etag, body)
+	}
+	resp, body = do(t, dhs, "GET", "/doc", "If-None-Match", etag)
+	if resp.StatusCode != http.StatusNotModified || body != "" {
+		t.Fatalf("matching If-None-Match got %d %q", resp.StatusCode, body)
+	}
+	resp, _ = do(t, dhs, "GET", "/doc", "If-None-Match", `"other"`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stale If-None-Match got %d", resp.StatusCode)
+	}
+	if resp, _ := do(t, dhs, "GET", "/stream"); resp.Header.Get("ETag") != "" {
+		t.Fatal("flushed response got an ETag")
+	}
+	if resp, _ := do(t, dhs, "POST", "/doc"); resp.Header.Get("ETag") != "" {
+		t.Fatal("POST response got an ETag")
+	}
+}
+
+func TestETagOfAutomaticHead(t *testing.T) {
+	for _, global := range []bool{false, true} {
+		dhs, url := startServer(t)
+		endpoint := &Endpoint{Methods: []string{"GET"}, Paths: []string{"/doc"}, Handler: text("document")}
+		if global {
+			dhs.Use(WithETag())
+		} else {
+			endpoint.Middleware = []Middleware{WithETag()}
+		}
+		dhs.AddEndpoint(endpoint)
+		get, err := http.Get(url + "/doc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		get.Body.Close()
+		head, err := http.Head(url + "/doc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		head.Body.Close()
+		if head.StatusCode != http.StatusOK {
+			t.Fatalf("global %v: HEAD got %d", global, head.StatusCode)
+		}
+		for _, name := range []string{"ETag", "Content-Length", "Content-Type"} {
+			if head.Header.Get(name) != get.Header.Get(name) {
+				t.Errorf("global %v: %s: HEAD %q, GET %q", global, name, head.Header.Get(name), get.Header.Get(name))
+			}
+		}
+		if get.Header.Get("Content-Length") != "8" {
+			t.Errorf("global %v: GET Content-Length %q", global, get.Header.Get("Content-Length"))
+		}
+
+		resp, body := do(t, dhs, "HEAD", "/doc", "If-None-Match", get.Header.Get("ETag"))
+		if resp.StatusCode != http.StatusNotModified || body != "" {
+			t.Fatalf("global %v: conditional HEAD got %d %q", global, resp.StatusCode, body)
+		}
+		// in memory too nothing of the body is sent
+		if resp, body := do(t, dhs, "HEAD", "/doc"); resp.Header.Get("ETag") != get.Header.Get("ETag") || body != "" {
+			t.Fatalf("global %v: HEAD got ETag %q, body %q", global, resp.Header.Get("ETag"), body)
+		}
+	}
+}
+
+func TestETagOfLargeHead(t *testing.T) {
+	dhs := newServer(t)
+	dhs.Use(WithETag())
+	large := strings.Repeat("x", etagMaxSize+1)
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"GET"}, Paths: []string{"/big"}, Handler: text(large)})
+	resp, body := do(t, dhs, "HEAD", "/big")
+	if resp.StatusCode != http.StatusOK || body != "" || resp.Header.Get("ETag") != "" {
+		t.Fatalf("large HEAD got %d, %d bytes, ETag %q", resp.StatusCode, len(body), resp.Header.Get("ETag"))
+	}
+}
@@ -0,0 +1,28 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strings"
+)
+
+// expectContinue runs vet on requests to next sending "Expect: 100-continue",
+// answering the ones it rejects straight away. net/http only sends the client the
+// interim 100 Continue once the body is first read, so a rejected client never
+// sends it and the connection is closed after the response instead of reused.
+func expectContinue(vet func(*http.Request) (int, bool), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		status, ok := vet(r)
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if status == 0 {
+			status = http.StatusExpectationFailed
+		}
+		http.Error(w, http.StatusText(status), status)
+	})
+}
@@ -0,0 +1,77 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpectContinue(t *testing.T) {
+	dhs, url := startServer(t)
+	dhs.AddEndpoint(&Endpoint{
+		Methods: []string{"PUT"},
+		Paths:   []string{"/upload"},
+		ExpectContinueHandler: func(r *http.Request) (int, bool) {
+			if r.Header.Get("Authorization") == "" {
+				return http.StatusUnauthorized, false
+			}
+			return 0, r.ContentLength <= 1000
+		},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "%d bytes", len(body))
+		},
+	})
+	// send writes the headers of an upload of size bytes without its body and
+	// returns the response, sending the body only once told to continue
+	send := func(authorization string, size int) (*http.Response, string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, "PUT /upload HTTP/1.1\r\nHost: test\r\nExpect: 100-continue\r\nContent-Length: %d\r\n", size)
+		if authorization != "" {
+			fmt.Fprintf(conn, "Authorization: %s\r\n", authorization)
+		}
+		fmt.Fprint(conn, "\r\n")
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode == http.StatusContinue {
+			conn.Write([]byte(strings.Repeat("x", size)))
+			if resp, err = http.ReadResponse(br, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		size          int
+		status        int
+	}{
+		{"missing credentials", "", 10, http.StatusUnauthorized},
+		{"too large", "Bearer t", 5000, http.StatusExpectationFailed},
+	} {
+		// the body is never sent, so reading it would stall until the deadline
+		resp, _ := send(tc.authorization, tc.size)
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s: got %d, want %d", tc.name, resp.StatusCode, tc.status)
+		}
+	}
+	if resp, body := send("Bearer t", 10); resp.StatusCode != http.StatusOK || body != "10 bytes" {
+		t.Fatalf("accepted upload got %d %q", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,43 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// routingFingerprint hashes everything about endpoints and the server-wide settings
+// which affects the router reloadEndpoints builds from them, so unchanged state can
+// skip the rebuild. Functions cannot be told apart, closures made from the same
+// literal sharing their code, so the generation of endpoints stands in for their
+// handlers and middleware. Callers must hold dhs.mu.
+func (dhs *DynHttpSrv) routingFingerprint(endpoints []*Endpoint) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\n", dhs.settingsVersion)
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(h, "%p %d %p %#v %#v %#v %v %v %d %d %d %d",
+			endpoint, endpoint.generation, endpoint.group, endpoint.Methods, endpoint.Paths,
+			endpoint.Hosts, endpoint.Headers, endpoint.Queries, endpoint.Priority,
+			endpoint.Timeout, endpoint.MaxBodySize, endpoint.MaxConcurrent)
+		for _, target := range methodHandlers(endpoint) {
+			fmt.Fprintf(h, " %#v", target.methods)
+		}
+		fmt.Fprintf(h, " %#v %q", endpoint.Schemes, endpoint.Name)
+		if endpoint.Uploads != nil {
+			fmt.Fprintf(h, " %+v", *endpoint.Uploads)
+		}
+		fmt.Fprintln(h)
+	}
+	return h.Sum64()
+}
+
+// lastGeneration is the generation most recently given to an endpoint
+var lastGeneration atomic.Uint64
+
+// touch gives endpoints a new generation, so the next reload rebuilds the router
+// even if only their functions changed. Callers must hold dhs.mu.
+func touch(endpoints []*Endpoint) {
+	for _, endpoint := range endpoints {
+		endpoint.generation = lastGeneration.Add(1)
+	}
+}
@@ -0,0 +1,61 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+// liveRouter returns the router currently serving requests
+func liveRouter(dhs *DynHttpSrv) any {
+	return dhs.Router.state().router
+}
+
+func TestNoOpReloadKeepsRouter(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/a"}, Handler: text("a")})
+	before := liveRouter(dhs)
+	dhs.mu.Lock()
+	dhs.reloadEndpoints()
+	dhs.reloadEndpoints()
+	dhs.unlock()
+	if liveRouter(dhs) != before {
+		t.Fatal("reloading unchanged endpoints rebuilt the router")
+	}
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/b"}, Handler: text("b")})
+	if liveRouter(dhs) == before {
+		t.Fatal("adding an endpoint kept the router")
+	}
+}
+
+// versioned returns a handler answering version, a new closure of one literal
+// every time
+func versioned(version string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(version))
+	}
+}
+
+func TestUpdateInPlaceSwapsClosures(t *testing.T) {
+	dhs := newServer(t)
+	endpoint := &Endpoint{Paths: []string{"/v"}, Handler: versioned("v1"), Middleware: []Middleware{tag("1")}}
+	dhs.AddEndpoint(endpoint)
+	expect(t, dhs, "GET", "/v", http.StatusOK, "v1")
+	endpoint.Handler = versioned("v2")
+	endpoint.Middleware = []Middleware{tag("2")}
+	if err := dhs.UpdateEndpoint(endpoint, endpoint); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := do(t, dhs, "GET", "/v")
+	if body != "v2" || resp.Header.Get("X-Order") != "2" {
+		t.Fatalf("got %q with middleware %q after updating the closures", body, resp.Header.Get("X-Order"))
+	}
+}
+
+func TestSetEndpointsSwapsClosures(t *testing.T) {
+	dhs := newServer(t)
+	endpoint := &Endpoint{Paths: []string{"/v"}, Handler: versioned("v1")}
+	dhs.SetEndpoints([]*Endpoint{endpoint})
+	endpoint.Handler = versioned("v2")
+	dhs.SetEndpoints([]*Endpoint{endpoint})
+	expect(t, dhs, "GET", "/v", http.StatusOK, "v2")
+}
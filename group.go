@@ -0,0 +1,67 @@
+package dynhttpsrv
+
+import (
+	"errors"
+	"strings"
+)
+
+// Group is a set of endpoints sharing a path prefix and middleware
+type Group struct {
+	dhs        *DynHttpSrv
+	prefix     string
+	middleware []Middleware
+}
+
+// Group returns a handle registering endpoints below prefix, each wrapped in mw
+// outside its own middleware
+func (dhs *DynHttpSrv) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		dhs:        dhs,
+		prefix:     strings.TrimSuffix(prefix, "/"),
+		middleware: mw,
+	}
+}
+
+// AddEndpoint registers endpoint with its Paths below the group prefix. An endpoint
+// without Paths serves everything below the prefix.
+func (g *Group) AddEndpoint(endpoint *Endpoint) error {
+	return g.AddEndpoints(endpoint)
+}
+
+// AddEndpoints registers all endpoints in the group reloading the router once. If any
+// of them cannot be added, none is.
+func (g *Group) AddEndpoints(endpoints ...*Endpoint) error {
+	g.dhs.mu.Lock()
+	defer g.dhs.unlock()
+	return g.dhs.addEndpoints(g, endpoints)
+}
+
+// DelEndpoint removes an endpoint of the group
+func (g *Group) DelEndpoint(endpoint *Endpoint) error {
+	g.dhs.mu.Lock()
+	defer g.dhs.unlock()
+	pos := g.dhs.indexOf(endpoint)
+	if pos == -1 || endpoint.group != g {
+		return errors.New("endpoint not found")
+	}
+	g.dhs.endpoints = append(g.dhs.endpoints[0:pos], g.dhs.endpoints[pos+1:]...)
+	return g.dhs.reloadEndpoints()
+}
+
+// Delete removes every endpoint of the group reloading the router once, and returns
+// how many were removed
+func (g *Group) Delete() (int, error) {
+	g.dhs.mu.Lock()
+	defer g.dhs.unlock()
+	return g.dhs.delEndpointsWhere(func(endpoint *Endpoint) bool {
+		return endpoint.group == g
+	})
+}
+
+// endpointPrefix returns the path prefix of the group endpoint belongs to, or ""
+func endpointPrefix(endpoint *Endpoint) string {
+	if endpoint.group == nil {
+		return ""
+	}
+	return endpoint.group.prefix
+}
@@ -0,0 +1,49 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	dhs := newServer(t)
+	api := dhs.Group("/api/v1", tag("g"))
+	api.AddEndpoints(
+		&Endpoint{Paths: []string{"/users"}, Handler: text("users")},
+		&Endpoint{Paths: []string{"/orders"}, Handler: text("orders")},
+	)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/users"}, Handler: text("plain users")})
+
+	resp, body := do(t, dhs, "GET", "/api/v1/users")
+	if resp.StatusCode != http.StatusOK || body != "users" || resp.Header.Get("X-Order") != "g" {
+		t.Fatalf("grouped route got %d %q, X-Order %q", resp.StatusCode, body, resp.Header.Get("X-Order"))
+	}
+	resp, body = do(t, dhs, "GET", "/users")
+	if body != "plain users" || resp.Header.Get("X-Order") != "" {
+		t.Fatalf("ungrouped route got %q, X-Order %q", body, resp.Header.Get("X-Order"))
+	}
+
+	if n, err := api.Delete(); n != 2 || err != nil {
+		t.Fatalf("Delete removed %d endpoints, %v", n, err)
+	}
+	expect(t, dhs, "GET", "/api/v1/users", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/api/v1/orders", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/users", http.StatusOK, "plain users")
+}
+
+func TestGroupDelEndpoint(t *testing.T) {
+	dhs := newServer(t)
+	api := dhs.Group("/api")
+	inside := &Endpoint{Paths: []string{"/a"}, Handler: text("a")}
+	outside := &Endpoint{Paths: []string{"/b"}, Handler: text("b")}
+	api.AddEndpoint(inside)
+	dhs.AddEndpoint(outside)
+	if err := api.DelEndpoint(outside); err == nil {
+		t.Fatal("group deleted an endpoint it does not own")
+	}
+	if err := api.DelEndpoint(inside); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/api/a", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/b", http.StatusOK, "b")
+}
@@ -0,0 +1,21 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// WithH2C serves cleartext HTTP/2, both through prior knowledge and through the
+// HTTP/1.1 Upgrade mechanism, alongside HTTP/1.1
+func WithH2C() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.h2c = true
+	}
+}
+
+// h2cHandler wraps next so cleartext HTTP/2 connections are served by it too
+func h2cHandler(next http.Handler) http.Handler {
+	return h2c.NewHandler(next, &http2.Server{})
+}
@@ -0,0 +1,38 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func TestH2C(t *testing.T) {
+	dhs, url := startServer(t, WithH2C(), WithRequestID())
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/proto"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}})
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get(url + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+		t.Fatalf("got %s %q", resp.Proto, body)
+	}
+	if resp.Header.Get(RequestIDHeader) == "" {
+		t.Fatal("server-wide middleware skipped over h2c")
+	}
+}
@@ -0,0 +1,71 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+)
+
+// Zero-downtime restarts hand the listening socket over to a new process:
+//
+//  1. The old process gets the socket with Listener, takes its file with
+//     (*net.TCPListener).File and starts the new process passing that file in
+//     exec.Cmd.ExtraFiles.
+//  2. The new process serves on the inherited descriptor with NewFromFD, the first
+//     entry of ExtraFiles being descriptor 3.
+//  3. Once the new process is ready, the old one calls StopAccepting so only the new
+//     one accepts connections, then cancels its context to drain and exit.
+//
+// Alternatively, servers created with WithReusePort can bind the same address at the
+// same time, the kernel spreading new connections across them, so a new process can
+// start listening before the old one stops accepting.
+
+// NewFromFD creates a new dynamic HTTP server serving on the listening socket
+// inherited as file descriptor fd and obeying cancelling through ctx
+func NewFromFD(ctx context.Context, fd uintptr, opts ...Option) (*DynHttpSrv, error) {
+	f := os.NewFile(fd, "listener")
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithListener(ctx, ln, opts...), nil
+}
+
+// Listener returns the listener the server accepts connections on, or nil if it
+// failed to bind one
+func (dhs *DynHttpSrv) Listener() net.Listener {
+	<-dhs.bound
+	return dhs.listener
+}
+
+// StopAccepting closes the listener so no new connections are accepted, while the
+// connections already open keep being served until the context is cancelled
+func (dhs *DynHttpSrv) StopAccepting() error {
+	<-dhs.bound
+	if dhs.serveListener == nil {
+		return dhs.err
+	}
+	dhs.acceptStopped.Store(true)
+	return dhs.serveListener.Close()
+}
+
+// onceCloseListener closes the wrapped listener only once, so StopAccepting followed
+// by shutdown is not reported as a failure
+type onceCloseListener struct {
+	net.Listener
+	once     *sync.Once
+	closeErr error
+}
+
+func newOnceCloseListener(ln net.Listener) *onceCloseListener {
+	return &onceCloseListener{Listener: ln, once: &sync.Once{}}
+}
+
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() {
+		l.closeErr = l.Listener.Close()
+	})
+	return l.closeErr
+}
@@ -0,0 +1,98 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package dynhttpsrv
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReusePortSharesTheAddress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	old, err := NewChecked(ctx, "127.0.0.1:0", WithLogger(nil), WithReusePort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := old.Addr()
+	fresh, err := NewChecked(ctx, addr.String(), WithLogger(nil), WithReusePort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("old")})
+	fresh.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("new")})
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	seen := map[string]int{}
+	for i := 0; i < 200 && (seen["old"] == 0 || seen["new"] == 0); i++ {
+		_, body := get(t, client, "http://"+addr.String()+"/")
+		seen[body]++
+	}
+	if seen["old"] == 0 || seen["new"] == 0 {
+		t.Fatalf("connections spread as %v", seen)
+	}
+
+	// once the old server stops accepting every connection reaches the new one
+	if err := old.StopAccepting(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, body := get(t, client, "http://"+addr.String()+"/"); body != "new" {
+			t.Fatalf("connection %d reached %q after StopAccepting", i, body)
+		}
+	}
+	cancel()
+	waitDone(t, old, 5*time.Second)
+	waitDone(t, fresh, 5*time.Second)
+	if err := old.ServerError(); err != nil {
+		t.Fatalf("old server reported %v", err)
+	}
+}
+
+func TestNewFromFD(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ln.(*net.TCPListener).File()
+	ln.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, err := NewFromFD(ctx, f.Fd(), WithLogger(nil))
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("inherited")})
+	if status, body := get(t, http.DefaultClient, "http://"+dhs.Listener().Addr().String()+"/"); status != http.StatusOK || body != "inherited" {
+		t.Fatalf("got %d %q", status, body)
+	}
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+}
+
+func TestStopAcceptingKeepsOpenConnections(t *testing.T) {
+	dhs, url := startServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("ok")})
+	client := &http.Client{Transport: &http.Transport{}}
+	if status, _ := get(t, client, url+"/"); status != http.StatusOK {
+		t.Fatalf("got %d", status)
+	}
+	if err := dhs.StopAccepting(); err != nil {
+		t.Fatal(err)
+	}
+	// the kept-alive connection is still served
+	if status, _ := get(t, client, url+"/"); status != http.StatusOK {
+		t.Fatalf("open connection got %d after StopAccepting", status)
+	}
+	fresh := &http.Client{Transport: &http.Transport{}}
+	if _, err := fresh.Get(url + "/"); err == nil {
+		t.Fatal("new connection accepted after StopAccepting")
+	}
+}
@@ -0,0 +1,60 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// AllMethods listed in Endpoint.Methods matches any method
+const AllMethods = "*"
+
+// keepHeadBodyKey marks the contexts of HEAD requests whose automatic HEAD route
+// must pass the GET body on, as a writer outside it uses it and discards it itself
+type keepHeadBodyKey struct{}
+
+// withoutBody serves HEAD requests with next, a GET handler, discarding the body it
+// writes but keeping its headers
+func withoutBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keep, _ := r.Context().Value(keepHeadBodyKey{}).(bool); keep {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(headWriter{w}, r)
+	})
+}
+
+// headWriter discards everything written to it, the header aside
+type headWriter struct {
+	http.ResponseWriter
+}
+
+// Write sniffs the Content-Type net/http would have from the discarded body
+func (hw headWriter) Write(b []byte) (int, error) {
+	if _, ok := hw.Header()["Content-Type"]; !ok && len(b) > 0 {
+		hw.Header().Set("Content-Type", http.DetectContentType(b))
+	}
+	return len(b), nil
+}
+
+// Flush sends the header, so handlers streaming their GET responses work on HEAD too
+func (hw headWriter) Flush() {
+	if flusher, ok := hw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (hw headWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := hw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (hw headWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
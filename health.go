@@ -0,0 +1,38 @@
+package dynhttpsrv
+
+import (
+	"io"
+	"net/http"
+)
+
+// AddHealthCheck registers a liveness endpoint at livePath which always answers 200
+// and a readiness endpoint at readyPath which answers 200 while readyFn returns nil
+// and 503 with the error otherwise. Readiness also fails once the server starts
+// shutting down so load balancers drain it. A nil readyFn only tracks shutdown.
+func (dhs *DynHttpSrv) AddHealthCheck(livePath, readyPath string, readyFn func() error) error {
+	live := &Endpoint{
+		Methods: []string{http.MethodGet, http.MethodHead},
+		Paths:   []string{livePath},
+		Handler: func(res http.ResponseWriter, req *http.Request) {
+			io.WriteString(res, "ok\n")
+		},
+	}
+	ready := &Endpoint{
+		Methods: []string{http.MethodGet, http.MethodHead},
+		Paths:   []string{readyPath},
+		Handler: func(res http.ResponseWriter, req *http.Request) {
+			if dhs.IsShuttingDown() {
+				http.Error(res, "shutting down", http.StatusServiceUnavailable)
+				return
+			}
+			if readyFn != nil {
+				if err := readyFn(); err != nil {
+					http.Error(res, err.Error(), http.StatusServiceUnavailable)
+					return
+				}
+			}
+			io.WriteString(res, "ok\n")
+		},
+	}
+	return dhs.AddEndpoints(live, ready)
+}
@@ -0,0 +1,50 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	dhs := newServer(t)
+	var readyErr error
+	if err := dhs.AddHealthCheck("/livez", "/readyz", func() error { return readyErr }); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/livez", http.StatusOK, "ok\n")
+	expect(t, dhs, "GET", "/readyz", http.StatusOK, "ok\n")
+	readyErr = errors.New("database unreachable")
+	expect(t, dhs, "GET", "/readyz", http.StatusServiceUnavailable, "database unreachable\n")
+	expect(t, dhs, "GET", "/livez", http.StatusOK, "ok\n")
+	if len(dhs.Endpoints()) != 2 {
+		t.Fatalf("%d endpoints registered", len(dhs.Endpoints()))
+	}
+}
+
+func TestHealthCheckDuringShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, _ := NewTestServer(ctx, WithLogger(nil), WithShutdownTimeout(5*time.Second))
+	dhs.AddHealthCheck("/livez", "/readyz", nil)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/slow"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}})
+	expect(t, dhs, "GET", "/readyz", http.StatusOK, "ok\n")
+	// keep shutdown draining while readiness is probed
+	go dhs.ServeRequest(httptest.NewRequest("GET", "/slow", nil))
+	<-started
+	cancel()
+	for !dhs.IsShuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	expect(t, dhs, "GET", "/readyz", http.StatusServiceUnavailable, "shutting down\n")
+	expect(t, dhs, "GET", "/livez", http.StatusOK, "ok\n")
+	close(release)
+	waitDone(t, dhs, 5*time.Second)
+}
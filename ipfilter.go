@@ -0,0 +1,62 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+)
+
+// WithIPFilter answers 403 to clients whose IP address is in one of the deny CIDRs,
+// or, if allow is not empty, in none of the allow ones. Entries may also be single
+// addresses. The client IP comes from the rightmost X-Forwarded-For entry on
+// servers created WithTrustForwardedFor. It panics if an entry does not parse.
+func WithIPFilter(allow, deny []string) Middleware {
+	allowed := mustParsePrefixes(allow)
+	denied := mustParsePrefixes(deny)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trustForwardedFor := false
+			if dhs := serverFrom(r.Context()); dhs != nil {
+				trustForwardedFor = dhs.trustForwardedFor
+			}
+			ip, err := netip.ParseAddr(clientIP(r, trustForwardedFor))
+			if err != nil || !ipAllowed(ip.Unmap(), allowed, denied) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ipAllowed(ip netip.Addr, allowed, denied []netip.Prefix) bool {
+	if containsIP(denied, ip) {
+		return false
+	}
+	return len(allowed) == 0 || containsIP(allowed, ip)
+}
+
+func containsIP(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParsePrefixes(entries []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				panic(fmt.Sprintf("dynhttpsrv: invalid IP filter entry %q: %v", entry, err))
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
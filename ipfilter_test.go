@@ -0,0 +1,77 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	dhs := newServer(t)
+	admin := WithIPFilter([]string{"10.0.0.0/8", "192.0.2.1"}, []string{"10.1.0.0/16"})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/admin"}, Middleware: []Middleware{admin}, Handler: text("admin")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/public"}, Handler: text("public")})
+	tests := []struct {
+		remote string
+		status int
+	}{
+		{"10.2.3.4:1234", http.StatusOK},
+		{"10.1.2.3:1234", http.StatusForbidden},
+		{"192.0.2.1:1234", http.StatusOK},
+		{"192.0.2.2:1234", http.StatusForbidden},
+		{"[::ffff:10.2.3.4]:1234", http.StatusOK},
+		{"[2001:db8::1]:1234", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.RemoteAddr = test.remote
+		if resp := dhs.ServeRequest(req); resp.StatusCode != test.status {
+			t.Errorf("%s: got %d, want %d", test.remote, resp.StatusCode, test.status)
+		}
+		req = httptest.NewRequest("GET", "/public", nil)
+		req.RemoteAddr = test.remote
+		if resp := dhs.ServeRequest(req); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: unfiltered endpoint got %d", test.remote, resp.StatusCode)
+		}
+	}
+}
+
+func TestIPFilterForwardedFor(t *testing.T) {
+	filter := WithIPFilter(nil, []string{"203.0.113.0/24"})
+	for _, trust := range []bool{false, true} {
+		var opts []Option
+		if trust {
+			opts = append(opts, WithTrustForwardedFor())
+		}
+		dhs := newServer(t, opts...)
+		dhs.AddEndpoint(&Endpoint{Paths: []string{"/admin"}, Middleware: []Middleware{filter}, Handler: text("admin")})
+		tests := []struct {
+			forwarded string
+			status    int
+		}{
+			{"203.0.113.9", http.StatusForbidden},
+			// a client prepending an address of its choice cannot escape the filter
+			{"198.51.100.1, 203.0.113.9", http.StatusForbidden},
+			{"203.0.113.9, 198.51.100.1", http.StatusOK},
+		}
+		for _, test := range tests {
+			status := test.status
+			if !trust {
+				status = http.StatusOK
+			}
+			resp, _ := do(t, dhs, "GET", "/admin", "X-Forwarded-For", test.forwarded)
+			if resp.StatusCode != status {
+				t.Errorf("trust %v, X-Forwarded-For %q: got %d, want %d", trust, test.forwarded, resp.StatusCode, status)
+			}
+		}
+	}
+}
+
+func TestIPFilterRejectsInvalidEntries(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithIPFilter accepted an invalid entry")
+		}
+	}()
+	WithIPFilter([]string{"10.0.0.0/33"}, nil)
+}
@@ -0,0 +1,103 @@
+package dynhttpsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// defaultJSONBodyLimit caps the request bodies DecodeJSON reads unless DecodeLimit
+// says otherwise
+const defaultJSONBodyLimit = 1 << 20
+
+// ErrInvalidJSON is wrapped by the errors DecodeJSON returns for request bodies which
+// are not a single valid JSON value of the expected type, or are too large, all of
+// which deserve a 400
+var ErrInvalidJSON = errors.New("invalid JSON body")
+
+// DecodeOption customizes DecodeJSON
+type DecodeOption func(*decodeConfig)
+
+type decodeConfig struct {
+	limit                 int64
+	disallowUnknownFields bool
+}
+
+// DecodeLimit caps the request body DecodeJSON reads at limit bytes instead of 1MiB
+func DecodeLimit(limit int64) DecodeOption {
+	return func(cfg *decodeConfig) {
+		cfg.limit = limit
+	}
+}
+
+// DisallowUnknownFields makes DecodeJSON reject objects with fields the target type
+// does not have
+func DisallowUnknownFields() DecodeOption {
+	return func(cfg *decodeConfig) {
+		cfg.disallowUnknownFields = true
+	}
+}
+
+// DecodeJSON decodes the JSON body of r into a T. Malformed, mistyped or oversized
+// bodies are reported with errors wrapping ErrInvalidJSON; errors reading the body
+// are returned as they are.
+func DecodeJSON[T any](r *http.Request, opts ...DecodeOption) (T, error) {
+	cfg := decodeConfig{limit: defaultJSONBodyLimit}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var v T
+	body := &jsonBody{r: io.LimitReader(r.Body, cfg.limit+1)}
+	decoder := json.NewDecoder(body)
+	if cfg.disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(&v)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after the JSON value")
+	}
+	switch {
+	case body.n > cfg.limit:
+		return v, fmt.Errorf("%w: body larger than %d bytes", ErrInvalidJSON, cfg.limit)
+	case body.err != nil:
+		return v, body.err
+	case err != nil:
+		return v, fmt.Errorf("%w: %w", ErrInvalidJSON, err)
+	}
+	return v, nil
+}
+
+// jsonBody counts the bytes read from r and keeps the error reading them failed
+// with, other than io.EOF
+type jsonBody struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (b *jsonBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// WriteJSON sends v encoded as JSON with status. If v cannot be encoded nothing is
+// written, so the caller can still answer with an error.
+func WriteJSON(w http.ResponseWriter, status int, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	_, err = w.Write(body)
+	return err
+}
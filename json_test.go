@@ -0,0 +1,76 @@
+package dynhttpsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type order struct {
+	ID    int      `json:"id"`
+	Items []string `json:"items"`
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Methods: []string{"POST"}, Paths: []string{"/orders"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		o, err := DecodeJSON[order](r, DisallowUnknownFields())
+		if err != nil {
+			WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		o.ID++
+		WriteJSON(w, http.StatusCreated, o)
+	}})
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id": 41, "items": ["tea"]}`))
+	resp := dhs.ServeRequest(req)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var got order
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil || got.ID != 42 || len(got.Items) != 1 {
+		t.Fatalf("decoded %+v, %v", got, err)
+	}
+
+	resp = dhs.ServeRequest(httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id": 1, "extra": true}`)))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown field got %d", resp.StatusCode)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		opts []DecodeOption
+	}{
+		{"malformed", `{"id":`, nil},
+		{"mistyped", `{"id": "one"}`, nil},
+		{"trailing data", `{"id": 1} {"id": 2}`, nil},
+		{"unknown field", `{"id": 1, "extra": true}`, []DecodeOption{DisallowUnknownFields()}},
+		{"too large", `{"id": 1, "items": ["aaaaaaaaaaaaaaaaaaaa"]}`, []DecodeOption{DecodeLimit(16)}},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		if _, err := DecodeJSON[order](r, test.opts...); !errors.Is(err, ErrInvalidJSON) {
+			t.Errorf("%s: got %v, want ErrInvalidJSON", test.name, err)
+		}
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"id": 1, "extra": true}`))
+	if _, err := DecodeJSON[order](r); err != nil {
+		t.Errorf("unknown field rejected by default: %v", err)
+	}
+}
+
+func TestWriteJSONUnencodable(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := WriteJSON(rec, http.StatusOK, map[string]any{"ch": make(chan int)}); err == nil {
+		t.Fatal("WriteJSON encoded a channel")
+	}
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+		t.Fatal("WriteJSON wrote a partial response")
+	}
+}
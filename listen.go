@@ -0,0 +1,65 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/netutil"
+)
+
+// unixPrefix marks addresses naming a Unix domain socket, as in "unix:/run/app.sock"
+const unixPrefix = "unix:"
+
+// listen creates the listener for addr, which is either a TCP address or a Unix
+// domain socket path prefixed with "unix:"
+func (dhs *DynHttpSrv) listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		return listenUnix(path, dhs.socketMode)
+	}
+	if addr == "" {
+		addr = ":http"
+	}
+	if dhs.reusePort {
+		lc := net.ListenConfig{Control: reusePortControl}
+		return lc.Listen(context.Background(), "tcp", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix listens on the socket at path, replacing a stale socket left behind by
+// a previous run, and applies mode to it unless mode is zero. The socket file is
+// removed when the listener is closed.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// limitConns caps how many connections ln has open at once when the server was
+// created WithMaxConns
+func (dhs *DynHttpSrv) limitConns(ln net.Listener) net.Listener {
+	if dhs.maxConns <= 0 {
+		return ln
+	}
+	return netutil.LimitListener(ln, dhs.maxConns)
+}
@@ -0,0 +1,145 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	// a socket left behind by a previous run
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, err := NewChecked(ctx, unixPrefix+path, WithLogger(nil), WithSocketMode(0o600))
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/hello"}, Handler: text("over unix")})
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode %v", info.Mode().Perm())
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	if status, body := get(t, client, "http://unix/hello"); status != http.StatusOK || body != "over unix" {
+		t.Fatalf("got %d %q", status, body)
+	}
+	client.CloseIdleConnections()
+
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket file left after shutdown: %v", err)
+	}
+}
+
+func TestUnixSocketRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	os.WriteFile(path, []byte("data"), 0o644)
+	if _, err := listenUnix(path, 0); err == nil {
+		t.Fatal("listened over a regular file")
+	}
+}
+
+func TestNewWithListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs := NewWithListener(ctx, ln, WithLogger(nil))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("injected")})
+	addr, err := dhs.Addr()
+	if err != nil || addr.String() != ln.Addr().String() {
+		t.Fatalf("Addr() = %v, %v, want %v", addr, err, ln.Addr())
+	}
+	resp, err := http.Get("http://" + addr.String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "injected" {
+		t.Fatalf("body %q", body)
+	}
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+	if _, err := ln.Accept(); err == nil {
+		t.Fatal("listener still open after shutdown")
+	}
+}
+
+func TestSlowHeadersAreCutOff(t *testing.T) {
+	_, url := startServer(t, WithReadHeaderTimeout(50*time.Millisecond))
+	conn, err := net.Dial("tcp", url[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// the request line arrives but the headers never finish
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("connection not closed by the server: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("connection closed after %v", elapsed)
+	}
+}
+
+func TestMaxConns(t *testing.T) {
+	dhs, url := startServer(t, WithMaxConns(1))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("ok")})
+	idle, err := net.Dial("tcp", url[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// give the server time to accept the connection taking the only slot
+	time.Sleep(50 * time.Millisecond)
+	statuses := make(chan int, 1)
+	go func() {
+		resp, err := (&http.Client{Transport: &http.Transport{}}).Get(url + "/")
+		if err != nil {
+			statuses <- 0
+			return
+		}
+		resp.Body.Close()
+		statuses <- resp.StatusCode
+	}()
+	select {
+	case status := <-statuses:
+		t.Fatalf("request beyond the connection cap served with %d", status)
+	case <-time.After(100 * time.Millisecond):
+	}
+	idle.Close()
+	select {
+	case status := <-statuses:
+		if status != http.StatusOK {
+			t.Fatalf("queued request got %d", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued request not served once a connection closed")
+	}
+}
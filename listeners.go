@@ -0,0 +1,149 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// extraListener is an additional address the server's routes are served on
+type extraListener struct {
+	server   *http.Server
+	listener net.Listener
+	done     chan struct{}
+}
+
+// AddListener starts serving the same endpoints on addr too, which takes the same
+// forms as the address passed to New, and returns the address bound. The extra
+// listener shares the router, settings and TLS configuration of the server and
+// stops with it.
+func (dhs *DynHttpSrv) AddListener(addr string) (net.Addr, error) {
+	dhs.listenersMu.Lock()
+	defer dhs.listenersMu.Unlock()
+	if dhs.IsShuttingDown() {
+		return nil, errors.New("server is shutting down")
+	}
+	ln, err := dhs.listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	main := dhs.server
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           main.Handler,
+		ReadTimeout:       main.ReadTimeout,
+		ReadHeaderTimeout: main.ReadHeaderTimeout,
+		WriteTimeout:      main.WriteTimeout,
+		IdleTimeout:       main.IdleTimeout,
+		MaxHeaderBytes:    main.MaxHeaderBytes,
+		ConnState:         main.ConnState,
+		ErrorLog:          main.ErrorLog,
+		BaseContext:       main.BaseContext,
+	}
+	if dhs.usesTLS() {
+		srv.TLSConfig = main.TLSConfig.Clone()
+	}
+	if dhs.keepAlivesDisabled {
+		srv.SetKeepAlivesEnabled(false)
+	}
+	ln = dhs.limitConns(ln)
+	extra := &extraListener{server: srv, listener: ln, done: make(chan struct{})}
+	dhs.extraListeners = append(dhs.extraListeners, extra)
+	go func() {
+		defer close(extra.done)
+		var err error
+		if dhs.usesTLS() {
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != http.ErrServerClosed {
+			dhs.logger.Error("Serving extra listener ended with error", "addr", ln.Addr().String(), "error", err)
+		}
+	}()
+	return ln.Addr(), nil
+}
+
+// SetKeepAlivesEnabled enables or disables HTTP keep-alives on every listener of the
+// server. Connections then close after their current request.
+func (dhs *DynHttpSrv) SetKeepAlivesEnabled(enabled bool) {
+	dhs.listenersMu.Lock()
+	defer dhs.listenersMu.Unlock()
+	dhs.keepAlivesDisabled = !enabled
+	dhs.server.SetKeepAlivesEnabled(enabled)
+	for _, extra := range dhs.extraListeners {
+		extra.server.SetKeepAlivesEnabled(enabled)
+	}
+}
+
+// KeepAlivesEnabled reports whether HTTP keep-alives are enabled
+func (dhs *DynHttpSrv) KeepAlivesEnabled() bool {
+	dhs.listenersMu.Lock()
+	defer dhs.listenersMu.Unlock()
+	return !dhs.keepAlivesDisabled
+}
+
+// Addrs blocks until the main listener is bound and returns its address followed by
+// the addresses of the listeners added with AddListener, or the error if binding
+// the main one failed
+func (dhs *DynHttpSrv) Addrs() ([]net.Addr, error) {
+	addr, err := dhs.Addr()
+	if err != nil {
+		return nil, err
+	}
+	dhs.listenersMu.Lock()
+	defer dhs.listenersMu.Unlock()
+	addrs := []net.Addr{addr}
+	for _, extra := range dhs.extraListeners {
+		addrs = append(addrs, extra.listener.Addr())
+	}
+	return addrs, nil
+}
+
+// shutdownServers gracefully shuts the main and extra listeners' servers down in
+// parallel, returning the first error
+func (dhs *DynHttpSrv) shutdownServers(ctx context.Context) error {
+	servers := []*http.Server{dhs.server}
+	for _, extra := range dhs.extras() {
+		servers = append(servers, extra.server)
+	}
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}(i, srv)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeServers force-closes the main and extra listeners' servers
+func (dhs *DynHttpSrv) closeServers() {
+	dhs.server.Close()
+	for _, extra := range dhs.extras() {
+		extra.server.Close()
+	}
+}
+
+// awaitExtraListeners waits for the extra listeners to stop serving
+func (dhs *DynHttpSrv) awaitExtraListeners() {
+	for _, extra := range dhs.extras() {
+		<-extra.done
+	}
+}
+
+func (dhs *DynHttpSrv) extras() []*extraListener {
+	dhs.listenersMu.Lock()
+	defer dhs.listenersMu.Unlock()
+	return dhs.extraListeners
+}
@@ -0,0 +1,87 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAddListener(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dhs, err := NewChecked(ctx, "127.0.0.1:0", WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := dhs.AddListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := dhs.Addrs()
+	if err != nil || len(addrs) != 2 || addrs[1].String() != extra.String() {
+		t.Fatalf("Addrs() = %v, %v", addrs, err)
+	}
+	client := &http.Client{Transport: &http.Transport{}}
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/shared"}, Handler: text("shared")})
+	for _, addr := range addrs {
+		if status, body := get(t, client, "http://"+addr.String()+"/shared"); status != http.StatusOK || body != "shared" {
+			t.Fatalf("%v: got %d %q", addr, status, body)
+		}
+	}
+	// reloads reach every listener
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/later"}, Handler: text("later")})
+	for _, addr := range addrs {
+		if status, _ := get(t, client, "http://"+addr.String()+"/later"); status != http.StatusOK {
+			t.Fatalf("%v: got %d", addr, status)
+		}
+	}
+	client.CloseIdleConnections()
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+	for _, addr := range addrs {
+		if conn, err := net.Dial("tcp", addr.String()); err == nil {
+			conn.Close()
+			t.Fatalf("%v still accepting after shutdown", addr)
+		}
+	}
+	if _, err := dhs.AddListener("127.0.0.1:0"); err == nil {
+		t.Fatal("AddListener succeeded after shutdown")
+	}
+}
+
+func TestKeepAlives(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dhs, err := NewChecked(ctx, "127.0.0.1:0", WithLogger(nil), WithoutKeepAlives())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := dhs.Addr()
+	url := "http://" + addr.String() + "/"
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("ok")})
+	client := &http.Client{Transport: &http.Transport{}}
+	// closes reports whether the server asked to close the connection after answering
+	closes := func() bool {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Close
+	}
+	if dhs.KeepAlivesEnabled() || !closes() {
+		t.Fatal("keep-alives enabled despite WithoutKeepAlives")
+	}
+	dhs.SetKeepAlivesEnabled(true)
+	if !dhs.KeepAlivesEnabled() || closes() {
+		t.Fatal("keep-alives still disabled after SetKeepAlivesEnabled(true)")
+	}
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+	if dhs.KeepAlivesEnabled() {
+		t.Fatal("keep-alives still enabled after shutdown")
+	}
+}
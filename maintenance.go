@@ -0,0 +1,68 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// maintenanceRetryAfter is the Retry-After, in seconds, of maintenance responses
+const maintenanceRetryAfter = 60
+
+// maintenance is the state of maintenance mode while it is on
+type maintenance struct {
+	body   []byte
+	exempt []string
+}
+
+// SetMaintenance turns maintenance mode on or off at once, without rebuilding the
+// router. While it is on every request but those for exemptPaths, such as health
+// checks, gets a 503 with body, or the status text if body is empty, and a
+// Retry-After header. The endpoints keep being registered meanwhile. exemptPaths
+// are matched as endpoint paths are: against the cleaned request path, unless
+// WithSkipClean is set, with the WithPathPrefix prefix removed.
+func (dhs *DynHttpSrv) SetMaintenance(on bool, body []byte, exemptPaths []string) {
+	if !on {
+		dhs.maintenance.Store(nil)
+		return
+	}
+	if len(body) == 0 {
+		body = []byte(http.StatusText(http.StatusServiceUnavailable) + "\n")
+	}
+	dhs.maintenance.Store(&maintenance{
+		body:   append([]byte(nil), body...),
+		exempt: append([]string(nil), exemptPaths...),
+	})
+}
+
+// inMaintenance answers the requests maintenance mode does not exempt while it is on
+func (dhs *DynHttpSrv) inMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := dhs.maintenance.Load()
+		if m == nil || dhs.exemptFromMaintenance(m, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header := w.Header()
+		header.Set("Content-Type", http.DetectContentType(m.body))
+		header.Set("Content-Length", strconv.Itoa(len(m.body)))
+		header.Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(m.body)
+	})
+}
+
+// exemptFromMaintenance reports whether the path r is routed by is one of the
+// paths m exempts
+func (dhs *DynHttpSrv) exemptFromMaintenance(m *maintenance, r *http.Request) bool {
+	path := r.URL.Path
+	if !dhs.skipClean {
+		path = cleanPath(path)
+	}
+	if dhs.pathPrefix != "" {
+		var ok bool
+		if path, ok = trimPathPrefix(path, dhs.pathPrefix); !ok {
+			return false
+		}
+	}
+	return containsString(m.exempt, path)
+}
@@ -0,0 +1,34 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMaintenance(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/orders"}, Handler: text("orders")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/healthz"}, Handler: text("healthy")})
+	dhs.SetMaintenance(true, []byte("back soon"), []string{"/healthz"})
+	resp, body := do(t, dhs, "GET", "/orders")
+	if resp.StatusCode != http.StatusServiceUnavailable || body != "back soon" || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("in maintenance got %d %q, Retry-After %q", resp.StatusCode, body, resp.Header.Get("Retry-After"))
+	}
+	expect(t, dhs, "GET", "/healthz", http.StatusOK, "healthy")
+	dhs.SetMaintenance(false, nil, nil)
+	expect(t, dhs, "GET", "/orders", http.StatusOK, "orders")
+}
+
+func TestMaintenanceExemptionsMatchRoutedPaths(t *testing.T) {
+	dhs := newServer(t, WithPathPrefix("/svc"))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/orders"}, Handler: text("orders")})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/healthz"}, Handler: text("healthy")})
+	dhs.SetMaintenance(true, nil, []string{"/healthz"})
+	expect(t, dhs, "GET", "/svc/healthz", http.StatusOK, "healthy")
+	// unclean paths are exempt too, and redirected to the clean one
+	expect(t, dhs, "GET", "/svc//healthz", http.StatusMovedPermanently, "")
+	expect(t, dhs, "GET", "/svc/orders/../healthz", http.StatusMovedPermanently, "")
+	for _, target := range []string{"/healthz", "/svc/orders", "/svc/healthz/../orders", "/other/healthz"} {
+		expect(t, dhs, "GET", target, http.StatusServiceUnavailable, "")
+	}
+}
@@ -0,0 +1,61 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+// Match reports which endpoint the live router would dispatch a method request for
+// path to, along with the path variables it would extract, without serving it. path
+// goes through the steps requests do before routing: it is cleaned, unless
+// WithSkipClean is set, so unclean paths report the endpoint they are redirected
+// to, and must lie below the WithPathPrefix prefix, which is then removed.
+func (dhs *DynHttpSrv) Match(method, path string) (*Endpoint, map[string]string, bool) {
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		return nil, nil, false
+	}
+	if !dhs.skipClean {
+		req.URL, _ = cleanURL(req.URL, dhs.useEncodedPath)
+	}
+	if dhs.pathPrefix != "" {
+		var ok bool
+		if req.URL, ok = stripURLPrefix(req.URL, dhs.pathPrefix); !ok {
+			return nil, nil, false
+		}
+	}
+	state := dhs.Router.state()
+	var match mux.RouteMatch
+	if !state.router.Match(req, &match) || match.Route == nil {
+		return nil, nil, false
+	}
+	endpoint, ok := state.endpoints[match.Route]
+	if !ok {
+		return nil, nil, false
+	}
+	return endpoint, match.Vars, true
+}
+
+// URL builds the URL of the endpoint called name in the live router, filling its
+// variables from pairs of names and values. URLs of endpoints without Hosts
+// carry only a path.
+func (dhs *DynHttpSrv) URL(name string, pairs ...string) (*url.URL, error) {
+	route := dhs.Router.state().router.Get(name)
+	if route == nil {
+		return nil, fmt.Errorf("no endpoint named %q", name)
+	}
+	u, err := route.URL(pairs...)
+	if err != nil {
+		return nil, err
+	}
+	if dhs.pathPrefix != "" {
+		u.Path = dhs.pathPrefix + u.Path
+		if u.RawPath != "" {
+			u.RawPath = dhs.pathPrefix + u.RawPath
+		}
+	}
+	return u, nil
+}
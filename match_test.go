@@ -0,0 +1,97 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMatchAgreesWithServing(t *testing.T) {
+	dhs := newServer(t)
+	wildcard := &Endpoint{Paths: []string{"/users/{id}"}, Handler: text("wildcard")}
+	me := &Endpoint{Paths: []string{"/users/me"}, Priority: 1, Handler: text("me")}
+	dhs.AddEndpoints(wildcard, me)
+
+	tests := []struct {
+		path string
+		want *Endpoint
+		body string
+	}{
+		{"/users/me", me, "me"},
+		{"/users/42", wildcard, "wildcard"},
+	}
+	for _, test := range tests {
+		endpoint, vars, ok := dhs.Match("GET", test.path)
+		if !ok || endpoint != test.want {
+			t.Fatalf("Match(%q) = %v, %v", test.path, endpoint, ok)
+		}
+		expect(t, dhs, "GET", test.path, http.StatusOK, test.body)
+		if endpoint == wildcard && vars["id"] != "42" {
+			t.Fatalf("vars %v", vars)
+		}
+	}
+	if _, _, ok := dhs.Match("GET", "/orders"); ok {
+		t.Fatal("Match found an endpoint for an unregistered path")
+	}
+}
+
+func TestURL(t *testing.T) {
+	dhs := newServer(t)
+	if err := dhs.AddEndpoint(&Endpoint{Name: "user", Paths: []string{"/users/{id}"}, Handler: text("user")}); err != nil {
+		t.Fatal(err)
+	}
+	u, err := dhs.URL("user", "id", "42")
+	if err != nil || u.String() != "/users/42" {
+		t.Fatalf("URL = %v, %v", u, err)
+	}
+	expect(t, dhs, "GET", u.String(), http.StatusOK, "user")
+	if _, err := dhs.URL("missing"); err == nil {
+		t.Fatal("URL built a link to an endpoint nobody named")
+	}
+	if err := dhs.AddEndpoint(&Endpoint{Name: "user", Paths: []string{"/people/{id}"}, Handler: text("people")}); err == nil {
+		t.Fatal("AddEndpoint accepted a duplicate name")
+	}
+	expect(t, dhs, "GET", "/people/42", http.StatusNotFound, "")
+}
+
+func TestURLUnderPathPrefix(t *testing.T) {
+	dhs := newServer(t, WithPathPrefix("/svc"))
+	dhs.AddEndpoint(&Endpoint{Name: "user", Paths: []string{"/users/{id}"}, Handler: text("user")})
+	u, err := dhs.URL("user", "id", "42")
+	if err != nil || u.String() != "/svc/users/42" {
+		t.Fatalf("URL = %v, %v", u, err)
+	}
+	expect(t, dhs, "GET", u.String(), http.StatusOK, "user")
+}
+
+func TestMatchCleansAndStripsPaths(t *testing.T) {
+	dhs := newServer(t, WithPathPrefix("/svc"))
+	users := &Endpoint{Paths: []string{"/users/{id}"}, Handler: text("user")}
+	dhs.AddEndpoint(users)
+	for _, tc := range []struct {
+		path string
+		want *Endpoint
+	}{
+		{"/svc/users/42", users},
+		// redirected to /svc/users/42 first
+		{"/svc/users/7/../42", users},
+		{"/svc//users/42", users},
+		{"/users/42", nil},
+		{"/svc/../users/42", nil},
+	} {
+		endpoint, vars, ok := dhs.Match("GET", tc.path)
+		if ok != (tc.want != nil) || endpoint != tc.want {
+			t.Fatalf("Match(%q) = %v, %v", tc.path, endpoint, ok)
+		}
+		if ok && vars["id"] != "42" {
+			t.Fatalf("Match(%q) vars %v", tc.path, vars)
+		}
+	}
+	expect(t, dhs, "GET", "/svc/users/42", http.StatusOK, "user")
+	expect(t, dhs, "GET", "/users/42", http.StatusNotFound, "")
+
+	raw := newServer(t, WithSkipClean(true))
+	raw.AddEndpoint(&Endpoint{Paths: []string{"/users/{id}"}, Handler: text("user")})
+	if _, _, ok := raw.Match("GET", "/users/7/../42"); ok {
+		t.Fatal("Match cleaned a path WithSkipClean")
+	}
+}
@@ -0,0 +1,23 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"time"
+)
+
+// MetricsSink receives one observation per served request. path is the matched
+// route template, such as "/users/{id}", or empty if no endpoint matched.
+type MetricsSink interface {
+	ObserveRequest(method, path string, status int, dur time.Duration)
+}
+
+// metrics reports every request served by next to sink
+func metrics(sink MetricsSink, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, state := withRequestState(r)
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+		sink.ObserveRequest(r.Method, state.route, rw.Status(), time.Since(start))
+	})
+}
@@ -0,0 +1,41 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingSink counts requests by method, route and status
+type countingSink struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (s *countingSink) ObserveRequest(method, path string, status int, dur time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = make(map[string]int)
+	}
+	s.counts[fmt.Sprintf("%s %s %d", method, path, status)]++
+}
+
+func TestMetrics(t *testing.T) {
+	sink := &countingSink{}
+	dhs := newServer(t, WithMetrics(sink))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/users/{id}"}, Handler: text("user")})
+	do(t, dhs, "GET", "/users/1")
+	do(t, dhs, "GET", "/users/2")
+	do(t, dhs, "DELETE", "/users/3")
+	do(t, dhs, "GET", "/missing")
+	want := map[string]int{
+		"GET /users/{id} 200":    2,
+		"DELETE /users/{id} 200": 1,
+		"GET  404":               1,
+	}
+	if fmt.Sprint(sink.counts) != fmt.Sprint(want) {
+		t.Fatalf("counts %v, want %v", sink.counts, want)
+	}
+}
@@ -0,0 +1,98 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Negotiated returns a handler dispatching each request to the entry of handlers,
+// keyed by media type such as "application/json", which best matches the request's
+// Accept header, with Content-Type set to that media type. Requests accepting none
+// of them are answered with a 406. A missing Accept header accepts anything.
+func Negotiated(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	offered := make([]string, 0, len(handlers))
+	for mediaType := range handlers {
+		offered = append(offered, mediaType)
+	}
+	sort.Strings(offered)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		mediaType := negotiateMediaType(r.Header.Values("Accept"), offered)
+		if mediaType == "" {
+			http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", mediaType)
+		handlers[mediaType](w, r)
+	}
+}
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// negotiateMediaType picks the entry of offered with the highest quality in the
+// Accept header values, taking each from its most specific matching media range, or
+// returns "" if none is acceptable. Ties go to the earliest entry of offered.
+func negotiateMediaType(accept []string, offered []string) string {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		ranges = []mediaRange{{typ: "*", subtype: "*", q: 1}}
+	}
+	best, bestQ := "", 0.0
+	for _, mediaType := range offered {
+		typ, subtype, _ := strings.Cut(strings.ToLower(mediaType), "/")
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			var s int
+			switch {
+			case mr.typ == typ && mr.subtype == subtype:
+				s = 2
+			case mr.typ == typ && mr.subtype == "*":
+				s = 1
+			case mr.typ == "*" && mr.subtype == "*":
+				s = 0
+			default:
+				continue
+			}
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// parseAccept parses Accept header values into media ranges, defaulting their
+// quality to 1
+func parseAccept(accept []string) []mediaRange {
+	var ranges []mediaRange
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, _ := strings.Cut(part, ";")
+			typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+			if !ok {
+				continue
+			}
+			mr := mediaRange{typ: typ, subtype: subtype, q: 1}
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(param, "=")
+				if strings.TrimSpace(strings.ToLower(name)) != "q" {
+					continue
+				}
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					mr.q = q
+				}
+			}
+			ranges = append(ranges, mr)
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,46 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNegotiated(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/item"}, Handler: Negotiated(map[string]http.HandlerFunc{
+		"application/json": text(`{"id":1}`),
+		"application/xml":  text(`<item id="1"/>`),
+	})})
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"application/json", http.StatusOK, "application/json"},
+		{"application/xml;q=0.9, application/json;q=0.8", http.StatusOK, "application/xml"},
+		{"application/xml;q=0.9, application/json", http.StatusOK, "application/json"},
+		{"text/html, application/*;q=0.5", http.StatusOK, "application/json"},
+		{"*/*;q=0.1, application/xml", http.StatusOK, "application/xml"},
+		{"application/json;q=0, */*", http.StatusOK, "application/xml"},
+		{"", http.StatusOK, "application/json"},
+		{"text/html", http.StatusNotAcceptable, ""},
+		{"application/json;q=0", http.StatusNotAcceptable, ""},
+	}
+	for _, test := range tests {
+		var header []string
+		if test.accept != "" {
+			header = []string{"Accept", test.accept}
+		}
+		resp, _ := do(t, dhs, "GET", "/item", header...)
+		if resp.StatusCode != test.status {
+			t.Errorf("Accept %q: got %d", test.accept, resp.StatusCode)
+			continue
+		}
+		if test.contentType != "" && resp.Header.Get("Content-Type") != test.contentType {
+			t.Errorf("Accept %q: Content-Type %q, want %q", test.accept, resp.Header.Get("Content-Type"), test.contentType)
+		}
+		if resp.Header.Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: Vary %q", test.accept, resp.Header.Get("Vary"))
+		}
+	}
+}
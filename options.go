@@ -0,0 +1,340 @@
+package dynhttpsrv
+
+import (
+	"compress/flate"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Option configures a DynHttpSrv when passed to New
+type Option func(dhs *DynHttpSrv)
+
+// WithShutdownTimeout sets how long shutdown waits for in-flight requests before
+// forcibly closing the remaining connections. Zero means wait forever.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.shutdownTimeout = d
+	}
+}
+
+// WithDrainTimeout sets how long shutdown lets in-flight requests finish on their
+// own before cancelling their contexts with ErrDrainTimeout as the cause, the
+// shutdown timeout still bounding the whole shutdown. Zero never cancels them.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.drainTimeout = d
+	}
+}
+
+// WithReadTimeout sets the maximum duration for reading an entire request
+func WithReadTimeout(d time.Duration) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.server.ReadTimeout = d
+	}
+}
+
+// WithReadHeaderTimeout sets the maximum duration for reading request headers. It
+// defaults to 10 seconds unless WithReadTimeout is set, which then bounds reading
+// headers too; a negative value disables it.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.server.ReadHeaderTimeout = d
+	}
+}
+
+// WithWriteTimeout sets the maximum duration before timing out writes of a response
+func WithWriteTimeout(d time.Duration) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.server.WriteTimeout = d
+	}
+}
+
+// WithIdleTimeout sets how long an idle keep-alive connection is kept open
+func WithIdleTimeout(d time.Duration) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.server.IdleTimeout = d
+	}
+}
+
+// WithoutKeepAlives starts the server with HTTP keep-alives disabled, which
+// SetKeepAlivesEnabled can change later
+func WithoutKeepAlives() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.keepAlivesDisabled = true
+		dhs.server.SetKeepAlivesEnabled(false)
+	}
+}
+
+// WithMaxConns caps how many connections each listener of the server has open at
+// once. Connections beyond the cap wait in the kernel backlog until others close.
+func WithMaxConns(n int) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.maxConns = n
+	}
+}
+
+// WithMaxHeaderBytes sets the maximum size of request headers
+func WithMaxHeaderBytes(n int) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.server.MaxHeaderBytes = n
+	}
+}
+
+// WithRecovery recovers panics raised by handlers, logging them and answering with a 500
+// instead of dropping the connection
+func WithRecovery() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.recovery = true
+	}
+}
+
+// WithPanicHandler enables recovery and routes every recovered panic to fn
+func WithPanicHandler(fn PanicHandler) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.recovery = true
+		dhs.panicHandler = fn
+	}
+}
+
+// WithAllowConflicts lets AddEndpoint register endpoints whose routes overlap
+// already registered ones, leaving precedence to registration order
+func WithAllowConflicts() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.allowConflicts = true
+	}
+}
+
+// WithAccessLog logs every request to logger. A nil logger disables access logging,
+// which is the default.
+func WithAccessLog(logger *slog.Logger) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.accessLogger = logger
+	}
+}
+
+// WithMetrics reports method, route template, status and duration of every request
+// to sink
+func WithMetrics(sink MetricsSink) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.metricsSink = sink
+	}
+}
+
+// WithRouteMiddleware wraps the handler of every endpoint in mw once routing has
+// matched it, so mw can inspect the matched route through mux.CurrentRoute
+func WithRouteMiddleware(mw ...Middleware) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.routeMiddleware = append(dhs.routeMiddleware, mw...)
+	}
+}
+
+// WithCORS answers CORS preflight requests and adds the Access-Control-* headers to
+// responses for the origins allowed by opts
+func WithCORS(opts CORSOptions) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.cors = &opts
+	}
+}
+
+// WithCompression compresses responses with gzip or deflate at level, as accepted by
+// the client, unless they are smaller than the compression threshold or of an
+// already compressed content type. It panics if level is not a compress/flate level.
+func WithCompression(level int) Option {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		panic(fmt.Sprintf("dynhttpsrv: invalid compression level %d", level))
+	}
+	return func(dhs *DynHttpSrv) {
+		dhs.compressionLevel = level
+		dhs.compression = true
+	}
+}
+
+// WithCompressionThreshold sets the minimum response size, in bytes, which
+// WithCompression compresses
+func WithCompressionThreshold(n int) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.compressionThreshold = n
+	}
+}
+
+// WithRequestTimeout sets the default Timeout of endpoints which do not set their own
+func WithRequestTimeout(d time.Duration) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.requestTimeout = d
+	}
+}
+
+// WithRateLimit limits every client to rps requests per second with bursts of up to
+// burst requests, answering 429 beyond that. Clients are told apart by IP address
+// unless WithRateLimitKey says otherwise. It panics unless rps is a positive finite
+// number and burst is at least 1.
+func WithRateLimit(rps float64, burst int) Option {
+	if !(rps > 0) || math.IsInf(rps, 1) {
+		panic(fmt.Sprintf("dynhttpsrv: invalid rate limit %v requests per second", rps))
+	}
+	if burst < 1 {
+		panic(fmt.Sprintf("dynhttpsrv: invalid rate limit burst %d", burst))
+	}
+	return func(dhs *DynHttpSrv) {
+		dhs.rateLimiter = newRateLimiter(rps, burst)
+	}
+}
+
+// WithRateLimitKey identifies rate limited clients through key, for example by API key
+func WithRateLimitKey(key func(*http.Request) string) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.rateLimitKey = key
+	}
+}
+
+// WithTrustForwardedFor takes the client IP from the rightmost X-Forwarded-For entry.
+// Use it only when exactly one proxy you control sits in front of the server and
+// appends the address it received the request from; otherwise clients can choose
+// their own IP.
+func WithTrustForwardedFor() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.trustForwardedFor = true
+	}
+}
+
+// WithSocketMode sets the permissions of the socket file when listening on a Unix
+// domain socket
+func WithSocketMode(mode os.FileMode) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.socketMode = mode
+	}
+}
+
+// WithReusePort sets SO_REUSEPORT on the TCP listener so several servers, such as an
+// old and a new process during a restart, can listen on the same address at once.
+// Listening fails on platforms without SO_REUSEPORT.
+func WithReusePort() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.reusePort = true
+	}
+}
+
+// WithReloadDebounce coalesces endpoint changes made less than d apart into a single
+// router rebuild, run once d elapsed after the last of them. Until then requests are
+// routed by the previous endpoints; FlushReload applies the changes at once.
+func WithReloadDebounce(d time.Duration) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.reloadDebounce = d
+	}
+}
+
+// WithoutValidation stops AddEndpoint from rejecting endpoints with unknown methods
+// or malformed route templates, which mux then silently leaves unmatched
+func WithoutValidation() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.skipValidation = true
+	}
+}
+
+// WithRequestID gives every request an ID, reusing the one in its X-Request-ID header
+// if any, which RequestID reads back, the response echoes and access logs and
+// recovered panics include
+func WithRequestID() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.requestID = true
+	}
+}
+
+// WithStrictSlash sets whether a path registered with a trailing slash redirects
+// requests without it, and the other way round, which is the default unless
+// WithMergeSlashes is set
+func WithStrictSlash(strictSlash bool) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.strictSlash = strictSlash
+	}
+}
+
+// WithMergeSlashes serves every path of an endpoint with and without a trailing
+// slash directly, so "/users" and "/users/" reach the same handler whatever the
+// method. It replaces the redirects of WithStrictSlash, which it overrides.
+func WithMergeSlashes() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.mergeSlashes = true
+	}
+}
+
+// WithStrictMethods stops endpoints listing GET from serving HEAD too
+func WithStrictMethods() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.strictMethods = true
+	}
+}
+
+// WithAutoOptions answers OPTIONS requests for the paths of endpoints with 204 and
+// an Allow header listing the methods the endpoints sharing the path serve
+func WithAutoOptions() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.autoOptions = true
+	}
+}
+
+// WithSchemeRedirect redirects requests an endpoint restricted by Schemes would
+// serve over another scheme to its first Schemes entry, instead of letting them
+// fall through
+func WithSchemeRedirect() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.schemeRedirect = true
+	}
+}
+
+// WithTrustForwardedProto takes the scheme of requests from the X-Forwarded-Proto
+// header, which only a trusted TLS-terminating proxy in front of the server should
+// be able to set
+func WithTrustForwardedProto() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.trustForwardedProto = true
+	}
+}
+
+// WithPathPrefix serves the endpoints under prefix, stripping it from request paths
+// before routing, so an endpoint registered as "/users" answers "/svc/users" when
+// prefix is "/svc". Requests outside prefix get a 404. Redirects to paths of the
+// same host outside prefix, including the trailing slash and scheme redirects, get
+// prefix added to their Location.
+func WithPathPrefix(prefix string) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.pathPrefix = normalizePathPrefix(prefix)
+	}
+}
+
+// WithSkipClean sets whether request paths are matched as sent instead of being
+// cleaned of double slashes and dot segments first
+func WithSkipClean(skipClean bool) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.skipClean = skipClean
+	}
+}
+
+// WithUseEncodedPath matches routes against the percent-encoded request path, so an
+// encoded slash does not separate path segments. Route variables are still decoded,
+// "/files/a%2Fb" giving "a/b" for "/files/{key}".
+func WithUseEncodedPath() Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.useEncodedPath = true
+	}
+}
+
+// WithMaxBodySize caps request bodies at n bytes for endpoints which do not set their
+// own MaxBodySize
+func WithMaxBodySize(n int64) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.maxBodySize = n
+	}
+}
+
+// WithLogger routes the server's own log output, such as lifecycle messages and
+// recovered panics, to logger instead of slog.Default(). A nil logger silences it.
+func WithLogger(logger *slog.Logger) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.logger = logger
+	}
+}
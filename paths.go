@@ -0,0 +1,83 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/gorilla/mux"
+)
+
+// cleanPaths redirects requests whose path holds double slashes or dot segments to
+// the cleaned path, like mux does unless told to skip cleaning. Unlike mux it keeps
+// the path prefix outside the router and, when matching encoded paths, cleans the
+// path as sent without escaping it a second time in the redirect.
+func cleanPaths(encoded bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, changed := cleanURL(r.URL, encoded)
+		if !changed {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Location", u.String())
+		w.WriteHeader(http.StatusMovedPermanently)
+	})
+}
+
+// cleanURL returns u with its path cleaned, as sent if encoded is set, and whether
+// cleaning changed it
+func cleanURL(u *url.URL, encoded bool) (*url.URL, bool) {
+	p := u.Path
+	if encoded {
+		p = u.EscapedPath()
+	}
+	cleaned := cleanPath(p)
+	if cleaned == p {
+		return u, false
+	}
+	c := *u
+	c.Path, c.RawPath = cleaned, ""
+	if encoded {
+		if unescaped, err := url.PathUnescape(cleaned); err == nil {
+			c.Path, c.RawPath = unescaped, cleaned
+		}
+	}
+	return &c, true
+}
+
+// cleanPath returns the canonical form of p as mux computes it, keeping a trailing
+// slash
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	cleaned := path.Clean(p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// unescapeVars decodes the route variables mux extracted from the encoded path, so
+// handlers see "a/b" for "a%2Fb" and the same values as without WithUseEncodedPath.
+// Variables which are not valid escapes are left as they are.
+func unescapeVars(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if len(vars) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		decoded := make(map[string]string, len(vars))
+		for name, value := range vars {
+			if unescaped, err := url.PathUnescape(value); err == nil {
+				value = unescaped
+			}
+			decoded[name] = value
+		}
+		next.ServeHTTP(w, mux.SetURLVars(r, decoded))
+	})
+}
@@ -0,0 +1,63 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPathMatching(t *testing.T) {
+	key := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "key %s", mux.Vars(r)["key"])
+	}
+	pair := func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		fmt.Fprintf(w, "pair %s|%s", vars["a"], vars["b"])
+	}
+	modes := map[string][]Option{
+		"default": nil,
+		"encoded": {WithUseEncodedPath()},
+		"raw":     {WithSkipClean(true)},
+	}
+	for _, tc := range []struct {
+		mode, target string
+		status       int
+		// want is the body, or the Location of redirects
+		want string
+	}{
+		{"default", "/files/a", http.StatusOK, "key a"},
+		{"default", "/files/a%20b", http.StatusOK, "key a b"},
+		{"default", "/files/a%2Fb", http.StatusOK, "pair a|b"},
+		{"default", "/files/./a", http.StatusMovedPermanently, "/files/a"},
+		{"default", "/files/a/../b", http.StatusMovedPermanently, "/files/b"},
+		{"default", "/files//a", http.StatusMovedPermanently, "/files/a"},
+		{"default", "/files/a/", http.StatusMovedPermanently, "/files/a"},
+
+		{"encoded", "/files/a", http.StatusOK, "key a"},
+		{"encoded", "/files/a%20b", http.StatusOK, "key a b"},
+		{"encoded", "/files/a%2Fb", http.StatusOK, "key a/b"},
+		{"encoded", "/files/a%2Fb/c", http.StatusOK, "pair a/b|c"},
+		{"encoded", "/files/a%2F..%2Fb", http.StatusOK, "key a/../b"},
+		{"encoded", "/files/./a%2Fb", http.StatusMovedPermanently, "/files/a%2Fb"},
+		{"encoded", "/files//a%2Fb", http.StatusMovedPermanently, "/files/a%2Fb"},
+		{"encoded", "/files/a%2Fb/../c", http.StatusMovedPermanently, "/files/c"},
+
+		{"raw", "/files/a%2Fb", http.StatusOK, "pair a|b"},
+		{"raw", "/files/./a", http.StatusOK, "pair .|a"},
+		{"raw", "/files//a", http.StatusNotFound, ""},
+	} {
+		dhs := newServer(t, modes[tc.mode]...)
+		dhs.AddEndpoint(&Endpoint{Paths: []string{"/files/{key}"}, Handler: key})
+		dhs.AddEndpoint(&Endpoint{Paths: []string{"/files/{a}/{b}"}, Handler: pair})
+		resp, body := do(t, dhs, "GET", tc.target)
+		got := body
+		if resp.StatusCode == http.StatusMovedPermanently {
+			got = resp.Header.Get("Location")
+		}
+		if resp.StatusCode != tc.status || tc.want != "" && got != tc.want {
+			t.Errorf("%s %s: got %d %q, want %d %q", tc.mode, tc.target, resp.StatusCode, got, tc.status, tc.want)
+		}
+	}
+}
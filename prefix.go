@@ -0,0 +1,143 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// normalizePathPrefix returns prefix with a leading and no trailing slash, or ""
+// if it is empty or "/"
+func normalizePathPrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+// stripPathPrefix serves requests whose path is prefix or lies below it through next
+// with prefix removed from the path, and the others through notFound. Redirects next
+// answers to paths of the request's host outside prefix, such as the trailing slash
+// and scheme redirects of the router or those of AddRedirect, get prefix added back
+// to their Location.
+func stripPathPrefix(prefix string, next, notFound http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := stripURLPrefix(r.URL, prefix)
+		if !ok {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		r2 := r.WithContext(r.Context())
+		r2.URL = u
+		next.ServeHTTP(&prefixWriter{ResponseWriter: w, prefix: prefix, host: r.Host}, r2)
+	})
+}
+
+// stripURLPrefix returns u with prefix removed from its path, or false if the path
+// is not prefix and does not lie below it
+func stripURLPrefix(u *url.URL, prefix string) (*url.URL, bool) {
+	path, ok := trimPathPrefix(u.Path, prefix)
+	if !ok {
+		return u, false
+	}
+	rawPath, ok := trimPathPrefix(u.RawPath, prefix)
+	if !ok {
+		rawPath = ""
+	}
+	stripped := *u
+	stripped.Path = path
+	stripped.RawPath = rawPath
+	return &stripped, true
+}
+
+// trimPathPrefix removes prefix from path if path is prefix or lies below it
+func trimPathPrefix(path, prefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return path, false
+	}
+	if rest == "" {
+		rest = "/"
+	}
+	return rest, true
+}
+
+// prefixWriter adds prefix back to the Location of redirects to paths of host which
+// lie outside it
+type prefixWriter struct {
+	http.ResponseWriter
+	prefix      string
+	host        string
+	wroteHeader bool
+}
+
+func (pw *prefixWriter) WriteHeader(status int) {
+	if !pw.wroteHeader && status >= http.StatusMultipleChoices && status < http.StatusBadRequest {
+		pw.prefixLocation()
+	}
+	if status >= http.StatusOK || status == http.StatusSwitchingProtocols {
+		pw.wroteHeader = true
+	}
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *prefixWriter) Write(b []byte) (int, error) {
+	pw.wroteHeader = true
+	return pw.ResponseWriter.Write(b)
+}
+
+// prefixLocation adds prefix to the Location header if it names a path of host
+// outside prefix
+func (pw *prefixWriter) prefixLocation() {
+	header := pw.Header()
+	location := header.Get("Location")
+	u, err := url.Parse(location)
+	if location == "" || err != nil || !strings.HasPrefix(u.Path, "/") {
+		return
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, pw.host) || u.Host == "" && u.Scheme != "" {
+		return
+	}
+	if _, ok := trimPathPrefix(u.Path, pw.prefix); ok {
+		return
+	}
+	u.Path = pw.prefix + u.Path
+	if u.RawPath != "" {
+		u.RawPath = pw.prefix + u.RawPath
+	}
+	header.Set("Location", u.String())
+}
+
+func (pw *prefixWriter) ReadFrom(src io.Reader) (int64, error) {
+	pw.wroteHeader = true
+	if readerFrom, ok := pw.ResponseWriter.(io.ReaderFrom); ok {
+		return readerFrom.ReadFrom(src)
+	}
+	return io.Copy(writerOnly{pw.ResponseWriter}, src)
+}
+
+func (pw *prefixWriter) Flush() {
+	pw.wroteHeader = true
+	if flusher, ok := pw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (pw *prefixWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := pw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	pw.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (pw *prefixWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
@@ -0,0 +1,78 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// ProxyOption customizes the reverse proxy AddProxy creates
+type ProxyOption func(*httputil.ReverseProxy)
+
+// WithProxyTransport makes the proxy reach the upstream through rt, for example to
+// bound dial and response header timeouts
+func WithProxyTransport(rt http.RoundTripper) ProxyOption {
+	return func(proxy *httputil.ReverseProxy) {
+		proxy.Transport = rt
+	}
+}
+
+// WithProxyModifyResponse lets fn alter the upstream's responses before they are
+// sent on. An error returned by fn is handled like an unreachable upstream.
+func WithProxyModifyResponse(fn func(*http.Response) error) ProxyOption {
+	return func(proxy *httputil.ReverseProxy) {
+		proxy.ModifyResponse = fn
+	}
+}
+
+// WithProxyErrorHandler replaces the default handling of upstream failures, which
+// logs them and answers 502
+func WithProxyErrorHandler(fn func(http.ResponseWriter, *http.Request, error)) ProxyOption {
+	return func(proxy *httputil.ReverseProxy) {
+		proxy.ErrorHandler = fn
+	}
+}
+
+// AddProxy registers and returns an endpoint forwarding requests below pathPrefix
+// to upstream, with pathPrefix stripped and X-Forwarded-For, X-Forwarded-Host and
+// X-Forwarded-Proto set. The endpoint is removed like any other, with DelEndpoint.
+func (dhs *DynHttpSrv) AddProxy(pathPrefix, upstream string, opts ...ProxyOption) (*Endpoint, error) {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(pathPrefix, "/")
+	logger := dhs.logger
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = strings.TrimPrefix(pr.In.URL.Path, prefix)
+			pr.Out.URL.RawPath = strings.TrimPrefix(pr.In.URL.RawPath, prefix)
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if clientClosed(r) {
+				logger.Debug("Proxy request abandoned by client", "path", r.URL.Path, "upstream", upstream)
+				return
+			}
+			logger.Error("Proxy request failed", "path", r.URL.Path, "upstream", upstream, "error", err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		},
+	}
+	for _, opt := range opts {
+		opt(proxy)
+	}
+	paths := []string{prefix + "/{path:.*}"}
+	if prefix != "" {
+		paths = append([]string{prefix}, paths...)
+	}
+	endpoint := &Endpoint{
+		Paths:   paths,
+		Handler: proxy.ServeHTTP,
+	}
+	if err := dhs.AddEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
@@ -0,0 +1,65 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "yes")
+		fmt.Fprintf(w, "%s %s xff=%s host=%s", r.Method, r.URL.RequestURI(), r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer backend.Close()
+	dhs, url := startServer(t)
+	endpoint, err := dhs.AddProxy("/api/", backend.URL+"/v2", WithProxyModifyResponse(func(resp *http.Response) error {
+		resp.Header.Set("X-Proxied", "1")
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(url + "/api/users?id=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	body := string(b)
+	host := url[len("http://"):]
+	if want := "GET /v2/users?id=7 xff=127.0.0.1 host=" + host; body != want {
+		t.Fatalf("backend saw %q, want %q", body, want)
+	}
+	if resp.Header.Get("X-Backend") != "yes" || resp.Header.Get("X-Proxied") != "1" {
+		t.Fatalf("response headers %v", resp.Header)
+	}
+
+	if err := dhs.DelEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := get(t, http.DefaultClient, url+"/api/users"); status != http.StatusNotFound {
+		t.Fatalf("removed proxy got %d", status)
+	}
+}
+
+func TestAddProxyUpstreamDown(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := "http://" + ln.Addr().String()
+	ln.Close()
+	dhs := newServer(t)
+	dhs.AddProxy("/default", down)
+	var handled error
+	dhs.AddProxy("/custom", down, WithProxyErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+	}))
+	expect(t, dhs, "GET", "/default/x", http.StatusBadGateway, "")
+	expect(t, dhs, "GET", "/custom/x", http.StatusServiceUnavailable, "upstream unavailable\n")
+	if handled == nil {
+		t.Fatal("custom error handler not called")
+	}
+}
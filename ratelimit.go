@@ -0,0 +1,105 @@
+package dynhttpsrv
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter keeps one token bucket per client key
+type rateLimiter struct {
+	mu        *sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		mu:        &sync.Mutex{},
+		rate:      rps,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of key, or reports how long until one is available
+func (rl *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.sweep(now)
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(rl.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rl.rate)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / rl.rate * float64(time.Second))
+}
+
+// sweep forgets buckets which have been idle long enough to have refilled, at most
+// once per refill period, so idle clients don't accumulate forever
+func (rl *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	if refill < time.Minute {
+		refill = time.Minute
+	}
+	if now.Sub(rl.lastSweep) < refill {
+		return
+	}
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// rateLimit answers 429 with a Retry-After header to clients exceeding the limiter,
+// identifying clients through key
+func rateLimit(rl *rateLimiter, key func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := rl.allow(key(r), time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client which sent r. When trustForwardedFor
+// is set it is the rightmost X-Forwarded-For entry, the one appended by the proxy in
+// front of the server, since anything left of it is supplied by the client.
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
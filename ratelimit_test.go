@@ -0,0 +1,95 @@
+package dynhttpsrv
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitBurst(t *testing.T) {
+	dhs := newServer(t, WithRateLimit(1, 3))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("ok")})
+	for i := 0; i < 3; i++ {
+		expect(t, dhs, "GET", "/", http.StatusOK, "ok")
+	}
+	resp, _ := do(t, dhs, "GET", "/")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst got %d", resp.StatusCode)
+	}
+	if wait, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || wait < 1 {
+		t.Fatalf("Retry-After %q", resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestRateLimitRefill(t *testing.T) {
+	rl := newRateLimiter(2, 1)
+	now := time.Now()
+	if ok, _ := rl.allow("a", now); !ok {
+		t.Fatal("first request refused")
+	}
+	if ok, wait := rl.allow("a", now); ok || wait != 500*time.Millisecond {
+		t.Fatalf("second request allowed %v, wait %v", ok, wait)
+	}
+	if ok, _ := rl.allow("b", now); !ok {
+		t.Fatal("other client shares the bucket")
+	}
+	if ok, _ := rl.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("bucket did not refill")
+	}
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	dhs := newServer(t, WithRateLimit(1, 1), WithTrustForwardedFor())
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("ok")})
+	// the client rotates the part of the header it controls, the proxy appends 203.0.113.7
+	expect(t, dhs, "GET", "/", http.StatusOK, "ok")
+	resp, _ := do(t, dhs, "GET", "/", "X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("first proxied request got %d", resp.StatusCode)
+	}
+	resp, _ = do(t, dhs, "GET", "/", "X-Forwarded-For", "198.51.100.2, 203.0.113.7")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For prefix evaded the limiter: %d", resp.StatusCode)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		forwarded []string
+		trust     bool
+		want      string
+	}{
+		{nil, true, "192.0.2.1"},
+		{[]string{"203.0.113.7"}, false, "192.0.2.1"},
+		{[]string{"203.0.113.7"}, true, "203.0.113.7"},
+		{[]string{"10.0.0.1, 203.0.113.7"}, true, "203.0.113.7"},
+		{[]string{"10.0.0.1", "203.0.113.7 "}, true, "203.0.113.7"},
+		{[]string{"203.0.113.7,"}, true, "192.0.2.1"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header["X-Forwarded-For"] = test.forwarded
+		if got := clientIP(r, test.trust); got != test.want {
+			t.Errorf("clientIP(%q, %v) = %q, want %q", test.forwarded, test.trust, got, test.want)
+		}
+	}
+}
+
+func TestWithRateLimitRejectsInvalidLimits(t *testing.T) {
+	for _, limit := range []struct {
+		rps   float64
+		burst int
+	}{{0, 1}, {-1, 1}, {math.NaN(), 1}, {math.Inf(1), 1}, {1, 0}, {1, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithRateLimit(%v, %d) did not panic", limit.rps, limit.burst)
+				}
+			}()
+			WithRateLimit(limit.rps, limit.burst)
+		}()
+	}
+}
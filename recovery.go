@@ -0,0 +1,69 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+)
+
+// PanicInfo describes a panic recovered from a handler along with the request it
+// was serving
+type PanicInfo struct {
+	Request *http.Request
+	Method  string
+	Path    string
+	// Route is the template of the matched route, such as "/users/{id}"
+	Route string
+	// RequestID is the ID WithRequestID assigned the request, if enabled
+	RequestID  string
+	RemoteAddr string
+	Recovered  interface{}
+	Stack      []byte
+}
+
+// PanicHandler is called with every panic recovered from a handler
+type PanicHandler func(info PanicInfo)
+
+// recoverer recovers panics raised by next, logs them, reports them to the
+// configured PanicHandler and answers with a 500
+func (dhs *DynHttpSrv) recoverer(next http.Handler) http.Handler {
+	onPanic := dhs.panicHandler
+	logger := dhs.logger
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			stack := debug.Stack()
+			message := http.StatusText(http.StatusInternalServerError)
+			attrs := []any{"path", r.URL.Path, "panic", recovered}
+			if id := RequestID(r.Context()); id != "" {
+				attrs = append(attrs, "request_id", id)
+				message += " (request " + id + ")"
+			}
+			logger.Error("Recovered panic", attrs...)
+			if onPanic != nil {
+				info := PanicInfo{
+					Request:    r,
+					Method:     r.Method,
+					Path:       r.URL.Path,
+					RequestID:  RequestID(r.Context()),
+					RemoteAddr: r.RemoteAddr,
+					Recovered:  recovered,
+					Stack:      stack,
+				}
+				if route := mux.CurrentRoute(r); route != nil {
+					info.Route, _ = route.GetPathTemplate()
+				}
+				onPanic(info)
+			}
+			http.Error(w, message, http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
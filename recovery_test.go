@@ -0,0 +1,55 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	var info PanicInfo
+	dhs := newServer(t, WithPanicHandler(func(i PanicInfo) { info = i }))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/users/{id}"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}})
+	dhs.AddEndpoint(&Endpoint{Handler: func(w http.ResponseWriter, r *http.Request) {
+		panic("catch-all")
+	}})
+	expect(t, dhs, "GET", "/users/1", http.StatusInternalServerError, "")
+	if info.Recovered != "boom" || info.Path != "/users/1" || len(info.Stack) == 0 {
+		t.Fatalf("panic handler got %+v", info)
+	}
+	expect(t, dhs, "GET", "/other", http.StatusInternalServerError, "")
+	if info.Recovered != "catch-all" {
+		t.Fatalf("panic handler got %v", info.Recovered)
+	}
+}
+
+func TestRecoveryIncludesRequestID(t *testing.T) {
+	dhs := newServer(t, WithRecovery(), WithRequestID())
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}})
+	resp, body := do(t, dhs, "GET", "/", "X-Request-ID", "req-1")
+	if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(body, "req-1") {
+		t.Fatalf("got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestPanicInfo(t *testing.T) {
+	var info PanicInfo
+	dhs := newServer(t, WithRequestID(), WithPanicHandler(func(i PanicInfo) { info = i }))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/users/{id}"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}})
+	do(t, dhs, "DELETE", "/users/42", RequestIDHeader, "req-42")
+	if info.Method != "DELETE" || info.Path != "/users/42" || info.Route != "/users/{id}" {
+		t.Fatalf("request fields %q %q %q", info.Method, info.Path, info.Route)
+	}
+	if info.RequestID != "req-42" || info.RemoteAddr == "" || info.Request == nil {
+		t.Fatalf("request ID %q, remote address %q", info.RequestID, info.RemoteAddr)
+	}
+	if !strings.Contains(string(info.Stack), "recovery_test.go") {
+		t.Fatal("stack does not reach the handler")
+	}
+}
@@ -0,0 +1,43 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// AddRedirect registers and returns an endpoint redirecting requests for fromPath to
+// toLocation with code, which must be a 3xx status. Variables of fromPath written as
+// {name} in toLocation are replaced by their values, so "/u/{id}" can redirect to
+// "/users/{id}". The endpoint is removed like any other, with DelEndpoint.
+func (dhs *DynHttpSrv) AddRedirect(fromPath, toLocation string, code int) (*Endpoint, error) {
+	if code < 300 || code > 399 {
+		return nil, fmt.Errorf("redirect status %d is not a 3xx", code)
+	}
+	endpoint := &Endpoint{
+		Paths: []string{fromPath},
+		Handler: func(res http.ResponseWriter, req *http.Request) {
+			http.Redirect(res, req, expandLocation(toLocation, mux.Vars(req)), code)
+		},
+	}
+	if err := dhs.AddEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// expandLocation replaces every {name} in location with the escaped value of the
+// variable name
+func expandLocation(location string, vars map[string]string) string {
+	if len(vars) == 0 {
+		return location
+	}
+	pairs := make([]string, 0, 2*len(vars))
+	for name, value := range vars {
+		pairs = append(pairs, "{"+name+"}", (&url.URL{Path: value}).EscapedPath())
+	}
+	return strings.NewReplacer(pairs...).Replace(location)
+}
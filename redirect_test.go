@@ -0,0 +1,39 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAddRedirect(t *testing.T) {
+	dhs := newServer(t)
+	static, err := dhs.AddRedirect("/old", "/new", http.StatusMovedPermanently)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dhs.AddRedirect("/u/{id}/{tab}", "/users/{id}?tab={tab}", http.StatusFound); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		target   string
+		status   int
+		location string
+	}{
+		{"/old", http.StatusMovedPermanently, "/new"},
+		{"/u/42/posts", http.StatusFound, "/users/42?tab=posts"},
+		{"/u/a%20b/x", http.StatusFound, "/users/a%20b?tab=x"},
+	}
+	for _, test := range tests {
+		resp, _ := do(t, dhs, "GET", test.target)
+		if resp.StatusCode != test.status || resp.Header.Get("Location") != test.location {
+			t.Errorf("%s: got %d to %q", test.target, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+	if err := dhs.DelEndpoint(static); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/old", http.StatusNotFound, "")
+	if _, err := dhs.AddRedirect("/bad", "/new", http.StatusOK); err == nil {
+		t.Fatal("AddRedirect accepted a 200")
+	}
+}
@@ -0,0 +1,42 @@
+package dynhttpsrv
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	logs := &recordHandler{}
+	dhs := newServer(t, WithRequestID(), WithAccessLog(slog.New(logs)))
+	var seen string
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}})
+
+	resp, _ := do(t, dhs, "GET", "/")
+	generated := resp.Header.Get(RequestIDHeader)
+	if generated == "" || generated != seen {
+		t.Fatalf("response ID %q, context ID %q", generated, seen)
+	}
+	resp, _ = do(t, dhs, "GET", "/", RequestIDHeader, "abc-123")
+	if got := resp.Header.Get(RequestIDHeader); got != "abc-123" || seen != "abc-123" {
+		t.Fatalf("incoming ID not reused: response %q, context %q", got, seen)
+	}
+	resp, _ = do(t, dhs, "GET", "/", RequestIDHeader, strings.Repeat("x", maxRequestIDLength+1))
+	if got := resp.Header.Get(RequestIDHeader); len(got) > maxRequestIDLength || got != seen {
+		t.Fatalf("oversized ID echoed: response %q, context %q", got, seen)
+	}
+
+	lines := logs.attrs("request")
+	if len(lines) != 3 {
+		t.Fatalf("%d access log lines", len(lines))
+	}
+	if got := lines[0]["request_id"].String(); got != generated {
+		t.Fatalf("access log request_id %q, want %q", got, generated)
+	}
+	if got := lines[1]["request_id"].String(); got != "abc-123" {
+		t.Fatalf("access log request_id %q, want abc-123", got)
+	}
+}
@@ -0,0 +1,53 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// requestState carries what routing learned about a request back out to the
+// server-wide wrappers, which run before the router has matched anything
+type requestState struct {
+	route    string
+	endpoint *Endpoint
+}
+
+type requestStateKey struct{}
+
+type serverKey struct{}
+
+// serverFrom returns the server whose connection ctx belongs to, if any
+func serverFrom(ctx context.Context) *DynHttpSrv {
+	dhs, _ := ctx.Value(serverKey{}).(*DynHttpSrv)
+	return dhs
+}
+
+// withRequestState returns r carrying a requestState, reusing the one already
+// attached by an outer wrapper if any
+func withRequestState(r *http.Request) (*http.Request, *requestState) {
+	if state := requestStateFrom(r.Context()); state != nil {
+		return r, state
+	}
+	state := &requestState{}
+	return r.WithContext(context.WithValue(r.Context(), requestStateKey{}, state)), state
+}
+
+func requestStateFrom(ctx context.Context) *requestState {
+	state, _ := ctx.Value(requestStateKey{}).(*requestState)
+	return state
+}
+
+// markRoute records the matched endpoint and route template into the request state,
+// attaching one for next if no outer wrapper did
+func markRoute(endpoint *Endpoint, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, state := withRequestState(r)
+		state.endpoint = endpoint
+		if route := mux.CurrentRoute(r); route != nil {
+			state.route, _ = route.GetPathTemplate()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,102 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter wraps an http.ResponseWriter recording the response status code,
+// the number of body bytes written and the first error a Write or ReadFrom
+// returned. It preserves http.Flusher, http.Hijacker and io.ReaderFrom by
+// delegating to the wrapped writer, and Unwrap lets http.ResponseController reach
+// any other optional interface.
+type responseWriter struct {
+	http.ResponseWriter
+	status   int
+	size     int64
+	writeErr error
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	if err != nil && rw.writeErr == nil {
+		rw.writeErr = err
+	}
+	return n, err
+}
+
+// Status returns the status code sent, which is 200 if the handler sent none
+func (rw *responseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *responseWriter) Flush() {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if readerFrom, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{rw.ResponseWriter}, src)
+	}
+	rw.size += n
+	// Reading src can fail too, but telling that apart would hide it from the
+	// sendfile optimisation of the wrapped writer
+	if err != nil && rw.writeErr == nil {
+		rw.writeErr = err
+	}
+	return n, err
+}
+
+// writerOnly hides every method but Write so io.Copy cannot recurse into ReadFrom
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,144 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fullStack returns options enabling every wrapper which replaces the
+// ResponseWriter on the way to an endpoint
+func fullStack() []Option {
+	return []Option{
+		WithAccessLog(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithMetrics(&countingSink{}),
+		WithRequestID(),
+		WithCompression(gzip.DefaultCompression),
+		WithRecovery(),
+		WithRouteMiddleware(WithServerTiming()),
+	}
+}
+
+func TestHijackThroughMiddleware(t *testing.T) {
+	dhs, url := startServer(t, fullStack()...)
+	hijacked := make(chan error, 1)
+	dhs.AddEndpoint(&Endpoint{
+		Paths:        []string{"/ws"},
+		Middleware:   []Middleware{WithETag()},
+		OnWriteError: func(*http.Request, error) {},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			hijacker, ok := w.(http.Hijacker)
+			if !ok {
+				hijacked <- errors.New("writer does not implement http.Hijacker")
+				return
+			}
+			conn, rw, err := hijacker.Hijack()
+			hijacked <- err
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\nhello")
+			rw.Flush()
+		},
+	})
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+	if err := <-hijacked; err != nil {
+		t.Fatalf("Hijack failed: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(reader)
+	if resp.StatusCode != http.StatusSwitchingProtocols || string(body) != "hello" {
+		t.Fatalf("got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestOptionalInterfacesThroughMiddleware(t *testing.T) {
+	dhs := newServer(t, fullStack()...)
+	var flusher, hijacker bool
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Middleware: []Middleware{WithETag()}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+	}})
+	do(t, dhs, "GET", "/", "Accept-Encoding", "gzip")
+	if !flusher || !hijacker {
+		t.Fatalf("handler writer is Flusher %v, Hijacker %v", flusher, hijacker)
+	}
+}
+
+var errBrokenPipe = errors.New("broken pipe")
+
+// failingWriter is a ResponseWriter whose client went away
+type failingWriter struct {
+	header http.Header
+}
+
+func (fw *failingWriter) Header() http.Header       { return fw.header }
+func (fw *failingWriter) WriteHeader(int)           {}
+func (fw *failingWriter) Write([]byte) (int, error) { return 0, errBrokenPipe }
+
+// failingReaderFrom fails through io.ReaderFrom as net/http's writer does
+type failingReaderFrom struct {
+	failingWriter
+}
+
+func (fw *failingReaderFrom) ReadFrom(io.Reader) (int64, error) { return 0, errBrokenPipe }
+
+func TestOnWriteError(t *testing.T) {
+	dhs := newServer(t)
+	var reported []error
+	onError := func(r *http.Request, err error) { reported = append(reported, err) }
+	handlers := map[string]http.HandlerFunc{
+		"/write": text("hello"),
+		"/copy": func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, strings.NewReader("hello"))
+		},
+		"/content": func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "hello.txt", time.Time{}, strings.NewReader("hello"))
+		},
+		"/fine": func(w http.ResponseWriter, r *http.Request) {},
+	}
+	for path, handler := range handlers {
+		dhs.AddEndpoint(&Endpoint{Paths: []string{path}, OnWriteError: onError, Handler: handler})
+	}
+	serve := func(w http.ResponseWriter, target string) {
+		req := httptest.NewRequest("GET", target, nil)
+		dhs.server.Handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), serverKey{}, dhs)))
+	}
+	for _, target := range []string{"/write", "/copy", "/content"} {
+		for _, w := range []http.ResponseWriter{
+			&failingWriter{header: http.Header{}},
+			&failingReaderFrom{failingWriter{header: http.Header{}}},
+		} {
+			reported = nil
+			serve(w, target)
+			if len(reported) != 1 || !errors.Is(reported[0], errBrokenPipe) {
+				t.Errorf("%s through %T reported %v", target, w, reported)
+			}
+		}
+	}
+	reported = nil
+	serve(&failingWriter{header: http.Header{}}, "/fine")
+	if len(reported) != 0 {
+		t.Fatalf("response without a body reported %v", reported)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package dynhttpsrv
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortControl fails as SO_REUSEPORT is not available on this platform
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
@@ -0,0 +1,38 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteTemplate returns the path template of the route r matched, such as
+// "/users/{id}". It returns false for requests which matched no route or a
+// catch-all endpoint's prefix route.
+func RouteTemplate(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	// Unlike Path routes, PathPrefix ones have a regexp not anchored at the end
+	re, err := route.GetPathRegexp()
+	if err != nil || !strings.HasSuffix(re, "$") {
+		return "", false
+	}
+	return template, true
+}
+
+// RouteName returns the Name of the endpoint r was routed to, whichever of its
+// routes matched, or "" if it matched none or an unnamed one
+func RouteName(r *http.Request) string {
+	state := requestStateFrom(r.Context())
+	if state == nil || state.endpoint == nil {
+		return ""
+	}
+	return state.endpoint.Name
+}
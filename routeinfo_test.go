@@ -0,0 +1,46 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteTemplate(t *testing.T) {
+	dhs := newServer(t)
+	report := func(w http.ResponseWriter, r *http.Request) {
+		template, ok := RouteTemplate(r)
+		fmt.Fprintf(w, "%s %v %s", template, ok, RouteName(r))
+	}
+	dhs.AddEndpoint(&Endpoint{Name: "user", Paths: []string{"/users/{id}"}, Handler: report})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/plain"}, Handler: report})
+	dhs.Group("/static").AddEndpoint(&Endpoint{Handler: report})
+	dhs.AddEndpoint(&Endpoint{Handler: report})
+	expect(t, dhs, "GET", "/users/42", http.StatusOK, "/users/{id} true user")
+	expect(t, dhs, "GET", "/plain", http.StatusOK, "/plain true ")
+	expect(t, dhs, "GET", "/static/app.js", http.StatusOK, " false ")
+	expect(t, dhs, "GET", "/elsewhere", http.StatusOK, " false ")
+	if _, ok := RouteTemplate(httptest.NewRequest("GET", "/users/42", nil)); ok {
+		t.Fatal("RouteTemplate reported a template for a request which was never routed")
+	}
+}
+
+func TestRouteNameOfEveryRoute(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Name: "people", Methods: []string{"GET"}, Hosts: []string{"a.test", "b.test"}, Paths: []string{"/users/{id}", "/people/{id}"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		template, ok := RouteTemplate(r)
+		w.Header().Set("X-Route", fmt.Sprintf("%s %v %s", RouteName(r), ok, template))
+	}})
+	for _, tc := range []struct{ method, target, want string }{
+		{"GET", "http://a.test/users/1", "people true /users/{id}"},
+		{"GET", "http://b.test/users/1", "people true /users/{id}"},
+		{"GET", "http://a.test/people/1", "people true /people/{id}"},
+		{"HEAD", "http://b.test/people/1", "people true /people/{id}"},
+	} {
+		resp, _ := do(t, dhs, tc.method, tc.target)
+		if got := resp.Header.Get("X-Route"); got != tc.want {
+			t.Errorf("%s %s: route %q, want %q", tc.method, tc.target, got, tc.want)
+		}
+	}
+}
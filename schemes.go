@@ -0,0 +1,41 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// registerSchemeRedirect adds routes redirecting the requests endpoint would serve
+// but for their scheme to the first of its Schemes
+func (dhs *DynHttpSrv) registerSchemeRedirect(router *mux.Router, endpoint *Endpoint) {
+	if len(endpoint.Schemes) == 0 {
+		return
+	}
+	scheme := strings.ToLower(endpoint.Schemes[0])
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := *r.URL
+		target.Scheme = scheme
+		target.Host = r.Host
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+	for _, route := range dhs.newRoutes(router, endpoint, endpointMethods(endpoint)) {
+		route.Handler(redirect)
+	}
+}
+
+// forwardedProto takes the scheme of requests from their X-Forwarded-Proto header,
+// as set by a TLS-terminating proxy, so Endpoint.Schemes matches on it
+func forwardedProto(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")))
+		if proto == "http" || proto == "https" {
+			r = r.WithContext(r.Context())
+			u := *r.URL
+			u.Scheme = proto
+			r.URL = &u
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSchemes(t *testing.T) {
+	secure := &Endpoint{Paths: []string{"/admin"}, Schemes: []string{"https"}, Handler: text("admin")}
+	plain := &Endpoint{Paths: []string{"/admin"}, Priority: -1, Handler: text("plain")}
+
+	dhs := newServer(t, WithAllowConflicts())
+	dhs.AddEndpoints(secure, plain)
+	expect(t, dhs, "GET", "/admin", http.StatusOK, "plain")
+	expect(t, dhs, "GET", "https://example.com/admin", http.StatusOK, "admin")
+	// the header is only trusted when asked to
+	if _, body := do(t, dhs, "GET", "/admin", "X-Forwarded-Proto", "https"); body != "plain" {
+		t.Fatalf("untrusted X-Forwarded-Proto reached %q", body)
+	}
+
+	proxied := newServer(t, WithTrustForwardedProto())
+	proxied.AddEndpoint(&Endpoint{Paths: []string{"/admin"}, Schemes: []string{"https"}, Handler: text("admin")})
+	expect(t, proxied, "GET", "/admin", http.StatusNotFound, "")
+	resp, body := do(t, proxied, "GET", "/admin", "X-Forwarded-Proto", "https")
+	if resp.StatusCode != http.StatusOK || body != "admin" {
+		t.Fatalf("forwarded https got %d %q", resp.StatusCode, body)
+	}
+
+	redirecting := newServer(t, WithSchemeRedirect())
+	redirecting.AddEndpoint(&Endpoint{Paths: []string{"/admin"}, Schemes: []string{"https"}, Handler: text("admin")})
+	resp, _ = do(t, redirecting, "GET", "http://example.com/admin?tab=1")
+	if resp.StatusCode != http.StatusMovedPermanently && resp.StatusCode != http.StatusPermanentRedirect {
+		t.Fatalf("wrong scheme got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Location"); got != "https://example.com/admin?tab=1" {
+		t.Fatalf("redirected to %q", got)
+	}
+}
@@ -0,0 +1,114 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type serverTimingKey struct{}
+
+// serverTimings collects the timing segments of a request
+type serverTimings struct {
+	mu       sync.Mutex
+	segments []string
+}
+
+// AddTiming adds a segment called name lasting d to the Server-Timing header of the
+// response to the request ctx belongs to, if served through WithServerTiming. name
+// must be an HTTP token. Segments added once the response is committed are dropped.
+func AddTiming(ctx context.Context, name string, d time.Duration) {
+	timings, _ := ctx.Value(serverTimingKey{}).(*serverTimings)
+	if timings == nil {
+		return
+	}
+	timings.mu.Lock()
+	timings.segments = append(timings.segments, timingSegment(name, d))
+	timings.mu.Unlock()
+}
+
+// WithServerTiming reports in a Server-Timing header how long the handler ran
+// until committing the response, as the "app" segment, along with the segments
+// handlers add through AddTiming
+func WithServerTiming() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timings := &serverTimings{}
+			tw := &timingWriter{ResponseWriter: w, timings: timings, start: time.Now()}
+			next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingKey{}, timings)))
+			tw.commit()
+		})
+	}
+}
+
+func timingSegment(name string, d time.Duration) string {
+	return name + ";dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// timingWriter adds the Server-Timing header right before the response is committed
+type timingWriter struct {
+	http.ResponseWriter
+	timings   *serverTimings
+	start     time.Time
+	committed bool
+}
+
+// commit adds the Server-Timing header unless the response was already committed
+func (tw *timingWriter) commit() {
+	if tw.committed {
+		return
+	}
+	tw.committed = true
+	tw.timings.mu.Lock()
+	segments := append(tw.timings.segments, timingSegment("app", time.Since(tw.start)))
+	tw.timings.mu.Unlock()
+	tw.Header().Add("Server-Timing", strings.Join(segments, ", "))
+}
+
+func (tw *timingWriter) WriteHeader(status int) {
+	if status >= http.StatusOK || status == http.StatusSwitchingProtocols {
+		tw.commit()
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingWriter) Write(b []byte) (int, error) {
+	tw.commit()
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timingWriter) ReadFrom(src io.Reader) (int64, error) {
+	tw.commit()
+	if readerFrom, ok := tw.ResponseWriter.(io.ReaderFrom); ok {
+		return readerFrom.ReadFrom(src)
+	}
+	return io.Copy(writerOnly{tw.ResponseWriter}, src)
+}
+
+func (tw *timingWriter) Flush() {
+	tw.commit()
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (tw *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	tw.committed = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
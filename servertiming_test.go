@@ -0,0 +1,38 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServerTiming(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Middleware: []Middleware{WithServerTiming()}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		AddTiming(r.Context(), "db", 15*time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		w.Write([]byte("ok"))
+		AddTiming(r.Context(), "late", time.Millisecond)
+	}})
+	resp, _ := do(t, dhs, "GET", "/")
+	header := resp.Header.Get("Server-Timing")
+	m := regexp.MustCompile(`^db;dur=15\.000, app;dur=([0-9.]+)$`).FindStringSubmatch(header)
+	if m == nil {
+		t.Fatalf("Server-Timing %q", header)
+	}
+	if app, _ := strconv.ParseFloat(m[1], 64); app < 5 || app > 5000 {
+		t.Fatalf("app segment of %vms for a handler sleeping 5ms", app)
+	}
+}
+
+func TestAddTimingWithoutServerTiming(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		AddTiming(r.Context(), "db", time.Millisecond)
+	}})
+	if resp, _ := do(t, dhs, "GET", "/"); resp.Header.Get("Server-Timing") != "" {
+		t.Fatalf("Server-Timing %q without WithServerTiming", resp.Header.Get("Server-Timing"))
+	}
+}
@@ -0,0 +1,209 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// singleFlightMaxSize is the largest response WithSingleFlight shares
+const singleFlightMaxSize = 1 << 20
+
+// WithSingleFlight runs the handler once for concurrent GET and HEAD requests
+// sharing the key keyFn computes, replaying the response of the first to the
+// others. The first request's context governs the shared run. Responses which are
+// streamed, hijacked or larger than 1MiB are not shared, nor are they with requests
+// differing in the headers their Vary header names; the other requests then run
+// the handler on their own. The default key is the method and URL, and requests
+// carrying Authorization or Cookie headers are not coalesced with it, as their
+// responses may be personal; a keyFn coalescing them must tell users apart itself.
+func WithSingleFlight(keyFn func(*http.Request) string) Middleware {
+	shared := func(r *http.Request) bool { return true }
+	if keyFn == nil {
+		keyFn = func(r *http.Request) string {
+			return r.Method + " " + r.Host + r.URL.RequestURI()
+		}
+		shared = func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "" && r.Header.Get("Cookie") == ""
+		}
+	}
+	var group singleflight.Group
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead || !shared(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var leader *flightWriter
+			result, _, _ := group.Do(r.Method+"\x00"+keyFn(r), func() (interface{}, error) {
+				leader = &flightWriter{ResponseWriter: w, header: make(http.Header)}
+				next.ServeHTTP(leader, r)
+				return leader.result(r), nil
+			})
+			if leader != nil {
+				if !leader.passthrough {
+					result.(*flightResponse).replay(w)
+				}
+				return
+			}
+			response := result.(*flightResponse)
+			if response == nil || !response.sharedWith(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			response.replay(w)
+		})
+	}
+}
+
+// flightResponse is a complete buffered response
+type flightResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	// request is the header of the request the response was produced for
+	request http.Header
+}
+
+// sharedWith reports whether the response may be replayed to r, which it may
+// unless r differs from the request it was produced for in a header it varies on
+func (fr *flightResponse) sharedWith(r *http.Request) bool {
+	for _, value := range fr.header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" || !slices.Equal(fr.request.Values(name), r.Header.Values(name)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (fr *flightResponse) replay(w http.ResponseWriter) {
+	header := w.Header()
+	for key, values := range fr.header {
+		header[key] = append([]string(nil), values...)
+	}
+	w.WriteHeader(fr.status)
+	w.Write(fr.body)
+}
+
+// flightWriter buffers the response of the request running a shared handler,
+// switching to passing it through once it turns out not to be shareable
+type flightWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	status      int
+	buf         []byte
+	passthrough bool
+}
+
+func (fw *flightWriter) Header() http.Header {
+	if fw.passthrough {
+		return fw.ResponseWriter.Header()
+	}
+	return fw.header
+}
+
+func (fw *flightWriter) WriteHeader(status int) {
+	if fw.passthrough {
+		fw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if fw.status != 0 {
+		return
+	}
+	if status < http.StatusOK && status != http.StatusSwitchingProtocols {
+		fw.passThrough()
+		fw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	fw.status = status
+}
+
+func (fw *flightWriter) Write(b []byte) (int, error) {
+	if fw.status == 0 {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if fw.passthrough {
+		return fw.ResponseWriter.Write(b)
+	}
+	if len(fw.buf)+len(b) > singleFlightMaxSize {
+		if err := fw.passThrough(); err != nil {
+			return 0, err
+		}
+		return fw.ResponseWriter.Write(b)
+	}
+	fw.buf = append(fw.buf, b...)
+	return len(b), nil
+}
+
+// passThrough sends the header and anything buffered so far, and stops buffering
+func (fw *flightWriter) passThrough() error {
+	if fw.passthrough {
+		return nil
+	}
+	fw.passthrough = true
+	header := fw.ResponseWriter.Header()
+	for key, values := range fw.header {
+		header[key] = values
+	}
+	if fw.status == 0 {
+		return nil
+	}
+	fw.ResponseWriter.WriteHeader(fw.status)
+	buf := fw.buf
+	fw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := fw.ResponseWriter.Write(buf)
+	return err
+}
+
+// result returns the buffered response to r, or nil if it was passed through
+func (fw *flightWriter) result(r *http.Request) *flightResponse {
+	if fw.passthrough {
+		return nil
+	}
+	status := fw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &flightResponse{status: status, header: fw.header, body: fw.buf, request: r.Header}
+}
+
+// Flush marks the response as streamed, sending it on unshared
+func (fw *flightWriter) Flush() {
+	if !fw.passthrough {
+		if fw.status == 0 {
+			fw.status = http.StatusOK
+		}
+		fw.passThrough()
+	}
+	if flusher, ok := fw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (fw *flightWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := fw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	fw.passthrough = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (fw *flightWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
@@ -0,0 +1,139 @@
+package dynhttpsrv
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flight serves concurrent requests built by newRequest through WithSingleFlight,
+// letting the handler finish only once all of them reached the middleware, and
+// returns how many times the handler ran and the bodies the requests got
+func flight(t *testing.T, n int, keyFn func(*http.Request) string, newRequest func(i int) *http.Request, handler func(http.ResponseWriter, *http.Request)) (int, []string) {
+	t.Helper()
+	dhs := newServer(t)
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	arrivals := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			arrived.Done()
+			next.ServeHTTP(w, r)
+		})
+	}
+	release := make(chan struct{})
+	var runs atomic.Int32
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/report"}, Middleware: []Middleware{arrivals, WithSingleFlight(keyFn)}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		runs.Add(1)
+		<-release
+		handler(w, r)
+	}})
+	bodies := make([]string, n)
+	var done sync.WaitGroup
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			body, _ := io.ReadAll(dhs.ServeRequest(newRequest(i)).Body)
+			bodies[i] = string(body)
+		}(i)
+	}
+	arrived.Wait()
+	// let the requests past the middleware join the flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	done.Wait()
+	return int(runs.Load()), bodies
+}
+
+func TestSingleFlight(t *testing.T) {
+	runs, bodies := flight(t, 20, nil, func(int) *http.Request {
+		return httptest.NewRequest("GET", "/report?day=1", nil)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "report")
+	})
+	if runs != 1 {
+		t.Fatalf("handler ran %d times for 20 identical requests", runs)
+	}
+	for _, body := range bodies {
+		if body != "report" {
+			t.Fatalf("request got %q", body)
+		}
+	}
+}
+
+func TestSingleFlightSkipsCredentials(t *testing.T) {
+	for _, header := range []string{"Authorization", "Cookie"} {
+		runs, bodies := flight(t, 5, nil, func(i int) *http.Request {
+			req := httptest.NewRequest("GET", "/report", nil)
+			req.Header.Set(header, fmt.Sprint(i))
+			return req
+		}, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.Header.Get(header))
+		})
+		if runs != 5 {
+			t.Fatalf("%s: handler ran %d times for 5 requests", header, runs)
+		}
+		for i, body := range bodies {
+			if body != fmt.Sprint(i) {
+				t.Fatalf("%s: request %d got %q", header, i, body)
+			}
+		}
+	}
+}
+
+func TestSingleFlightCustomKey(t *testing.T) {
+	// the key tells users apart, so their requests may be coalesced
+	runs, bodies := flight(t, 6, func(r *http.Request) string {
+		return r.URL.Path + " " + r.Header.Get("Authorization")
+	}, func(i int) *http.Request {
+		req := httptest.NewRequest("GET", "/report", nil)
+		req.Header.Set("Authorization", fmt.Sprint(i%2))
+		return req
+	}, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	})
+	if runs != 2 {
+		t.Fatalf("handler ran %d times for 2 users", runs)
+	}
+	for i, body := range bodies {
+		if body != fmt.Sprint(i%2) {
+			t.Fatalf("request %d got %q", i, body)
+		}
+	}
+}
+
+func TestSingleFlightHonoursVary(t *testing.T) {
+	languages := []string{"en", "en", "fr"}
+	_, bodies := flight(t, len(languages), nil, func(i int) *http.Request {
+		req := httptest.NewRequest("GET", "/report", nil)
+		req.Header.Set("Accept-Language", languages[i])
+		return req
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(w, r.Header.Get("Accept-Language"))
+	})
+	for i, body := range bodies {
+		if body != languages[i] {
+			t.Fatalf("request for %q got %q", languages[i], body)
+		}
+	}
+}
+
+func TestSingleFlightSkipsLargeResponses(t *testing.T) {
+	large := make([]byte, singleFlightMaxSize+1)
+	_, bodies := flight(t, 3, nil, func(int) *http.Request {
+		return httptest.NewRequest("GET", "/report", nil)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(large)
+	})
+	for _, body := range bodies {
+		if len(body) != len(large) {
+			t.Fatalf("request got %d bytes, want %d", len(body), len(large))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// errStreamClosed is returned by an SSE send function once the stream has ended
+var errStreamClosed = errors.New("event stream closed")
+
+// NewSSEEndpoint returns an endpoint streaming Server-Sent Events at path, to be
+// registered with AddEndpoint. For every subscriber produce is called with a send
+// function writing and flushing one event. The ctx passed to produce is cancelled
+// when the client goes away or the server starts shutting down, and the stream ends
+// when produce returns.
+func NewSSEEndpoint(path string, produce func(ctx context.Context, send func(event, data string) error)) *Endpoint {
+	return &Endpoint{
+		Methods: []string{http.MethodGet},
+		Paths:   []string{path},
+		Timeout: -1,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+				return
+			}
+			header := w.Header()
+			header.Set("Content-Type", "text/event-stream")
+			header.Set("Cache-Control", "no-cache")
+			header.Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			flusher.Flush()
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			if dhs := serverFrom(ctx); dhs != nil {
+				go func() {
+					select {
+					case <-dhs.stopping:
+						cancel()
+					case <-ctx.Done():
+					}
+				}()
+			}
+
+			mu := &sync.Mutex{}
+			closed := false
+			send := func(event, data string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if closed {
+					return errStreamClosed
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if _, err := w.Write(formatEvent(event, data)); err != nil {
+					return err
+				}
+				flusher.Flush()
+				return nil
+			}
+			produce(ctx, send)
+
+			mu.Lock()
+			closed = true
+			mu.Unlock()
+		},
+	}
+}
+
+// formatEvent encodes one Server-Sent Event, splitting data over as many data lines
+// as it has lines
+func formatEvent(event, data string) []byte {
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
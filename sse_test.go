@@ -0,0 +1,81 @@
+package dynhttpsrv
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	dhs, url := startServer(t)
+	exited := make(chan struct{})
+	dhs.AddEndpoint(NewSSEEndpoint("/events", func(ctx context.Context, send func(event, data string) error) {
+		defer close(exited)
+		send("greeting", "hello")
+		send("", "line one\nline two")
+		<-ctx.Done()
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", url+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type %q", got)
+	}
+	reader := bufio.NewReader(resp.Body)
+	var events []string
+	var event strings.Builder
+	for len(events) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "\n" {
+			events = append(events, event.String())
+			event.Reset()
+			continue
+		}
+		event.WriteString(line)
+	}
+	if events[0] != "event: greeting\ndata: hello\n" || events[1] != "data: line one\ndata: line two\n" {
+		t.Fatalf("events %q", events)
+	}
+	cancel()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("producer still running after the client went away")
+	}
+}
+
+func TestSSEStopsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dhs, client := NewTestServer(ctx, WithLogger(nil))
+	exited := make(chan struct{})
+	dhs.AddEndpoint(NewSSEEndpoint("/events", func(ctx context.Context, send func(event, data string) error) {
+		defer close(exited)
+		send("", "first")
+		<-ctx.Done()
+	}))
+	resp, err := client.Get("http://test/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	bufio.NewReader(resp.Body).ReadString('\n')
+	cancel()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("producer still running after shutdown began")
+	}
+	resp.Body.Close()
+	waitDone(t, dhs, 5*time.Second)
+}
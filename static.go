@@ -0,0 +1,41 @@
+package dynhttpsrv
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ServeStatic returns an endpoint serving the files below dir under urlPrefix, to be
+// registered with AddEndpoint. Requests cannot reach files outside dir.
+func ServeStatic(urlPrefix, dir string) *Endpoint {
+	return staticEndpoint(urlPrefix, http.Dir(dir))
+}
+
+// ServeStaticFS is like ServeStatic but serves the files of fsys, such as an embed.FS
+func ServeStaticFS(urlPrefix string, fsys fs.FS) *Endpoint {
+	return staticEndpoint(urlPrefix, http.FS(fsys))
+}
+
+// staticEndpoint serves the files of root. The file path is taken from the route
+// variable rather than by stripping urlPrefix, so the prefixes of a Group or of
+// WithPathPrefix do not end up in it.
+func staticEndpoint(urlPrefix string, root http.FileSystem) *Endpoint {
+	prefix := strings.TrimSuffix(urlPrefix, "/")
+	files := http.FileServer(root)
+	return &Endpoint{
+		Methods: []string{http.MethodGet, http.MethodHead},
+		Paths:   []string{prefix + "/{path:.*}"},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			r2 := new(http.Request)
+			*r2 = *r
+			u := *r.URL
+			u.Path = "/" + mux.Vars(r)["path"]
+			u.RawPath = ""
+			r2.URL = &u
+			files.ServeHTTP(w, r2)
+		},
+	}
+}
@@ -0,0 +1,87 @@
+package dynhttpsrv
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//go:embed testdata/static
+var staticFiles embed.FS
+
+func TestServeStatic(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "public")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0644)
+	os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644)
+	dhs, client := newServerClient(t)
+	if err := dhs.AddEndpoint(ServeStatic("/assets/", dir)); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := get(t, client, "http://test/assets/app.js"); status != http.StatusOK || body != "console.log(1)" {
+		t.Fatalf("got %d %q", status, body)
+	}
+	for _, target := range []string{
+		"/assets/../secret.txt",
+		"/assets/../../etc/passwd",
+		"/assets/%2e%2e/secret.txt",
+		"/assets/..%2fsecret.txt",
+	} {
+		if status, body := get(t, client, "http://test"+target); status != http.StatusNotFound {
+			t.Errorf("%s: got %d %q, want 404", target, status, body)
+		}
+	}
+}
+
+func TestServeStaticWithoutCleaning(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "public")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644)
+	dhs := newServer(t, WithSkipClean(true))
+	dhs.AddEndpoint(ServeStatic("/assets", dir))
+	expect(t, dhs, "GET", "/assets/../secret.txt", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/assets/../../etc/passwd", http.StatusNotFound, "")
+}
+
+func TestServeStaticFS(t *testing.T) {
+	files, err := fs.Sub(staticFiles, "testdata/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dhs := newServer(t)
+	dhs.AddEndpoint(ServeStaticFS("/static", files))
+	expect(t, dhs, "GET", "/static/hello.txt", http.StatusOK, "embedded hello\n")
+	expect(t, dhs, "GET", "/static/sub/nested.txt", http.StatusOK, "nested\n")
+	expect(t, dhs, "GET", "/static/missing.txt", http.StatusNotFound, "")
+}
+
+func TestServeStaticBelowPrefixes(t *testing.T) {
+	files, _ := fs.Sub(staticFiles, "testdata/static")
+	dhs := newServer(t, WithPathPrefix("/svc"))
+	if err := dhs.Group("/ui").AddEndpoint(ServeStaticFS("/static", files)); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/svc/ui/static/hello.txt", http.StatusOK, "embedded hello\n")
+	expect(t, dhs, "GET", "/svc/ui/static/sub/nested.txt", http.StatusOK, "nested\n")
+}
+
+func TestHandlerObj(t *testing.T) {
+	dhs, client := newServerClient(t)
+	files, _ := fs.Sub(staticFiles, "testdata/static")
+	// an endpoint without Paths serves everything below the group prefix
+	err := dhs.Group("/files").AddEndpoint(&Endpoint{HandlerObj: http.StripPrefix("/files", http.FileServer(http.FS(files)))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := get(t, client, "http://test/files/hello.txt"); status != http.StatusOK || body != "embedded hello\n" {
+		t.Fatalf("got %d %q", status, body)
+	}
+	if status, _ := get(t, client, "http://test/files/missing.txt"); status != http.StatusNotFound {
+		t.Fatalf("missing file got %d", status)
+	}
+}
@@ -0,0 +1,83 @@
+package dynhttpsrv
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ServerStats is a snapshot of the requests and connections a server is handling
+type ServerStats struct {
+	// ActiveRequests counts the requests being handled right now
+	ActiveRequests int64
+	// TotalRequests counts the requests handled since the server started
+	TotalRequests uint64
+	// NewConns, ActiveConns and IdleConns count the open connections in each
+	// http.ConnState
+	NewConns    int
+	ActiveConns int
+	IdleConns   int
+	// TotalConns counts the connections accepted since the server started
+	TotalConns uint64
+}
+
+// serverStats keeps the counters behind ServerStats
+type serverStats struct {
+	activeRequests atomic.Int64
+	totalRequests  atomic.Uint64
+
+	mu         sync.Mutex
+	conns      map[net.Conn]http.ConnState
+	byState    map[http.ConnState]int
+	totalConns uint64
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		conns:   make(map[net.Conn]http.ConnState),
+		byState: make(map[http.ConnState]int),
+	}
+}
+
+// connState is installed as the http.Server's ConnState hook
+func (s *serverStats) connState(conn net.Conn, state http.ConnState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if previous, ok := s.conns[conn]; ok {
+		s.byState[previous]--
+	} else {
+		s.totalConns++
+	}
+	if state == http.StateHijacked || state == http.StateClosed {
+		delete(s.conns, conn)
+		return
+	}
+	s.conns[conn] = state
+	s.byState[state]++
+}
+
+// countRequests counts the requests running through next
+func (s *serverStats) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.totalRequests.Add(1)
+		s.activeRequests.Add(1)
+		defer s.activeRequests.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stats returns the current request and connection counts
+func (dhs *DynHttpSrv) Stats() ServerStats {
+	s := dhs.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ServerStats{
+		ActiveRequests: s.activeRequests.Load(),
+		TotalRequests:  s.totalRequests.Load(),
+		NewConns:       s.byState[http.StateNew],
+		ActiveConns:    s.byState[http.StateActive],
+		IdleConns:      s.byState[http.StateIdle],
+		TotalConns:     s.totalConns,
+	}
+}
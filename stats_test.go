@@ -0,0 +1,46 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	dhs, url := startServer(t)
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/slow"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}})
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(url + "/slow")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	stats := dhs.Stats()
+	if stats.ActiveRequests != 3 || stats.ActiveConns != 3 {
+		t.Fatalf("during the requests got %+v", stats)
+	}
+	close(release)
+	wg.Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for dhs.Stats().ActiveRequests != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stats = dhs.Stats()
+	if stats.ActiveRequests != 0 || stats.TotalRequests != 3 || stats.TotalConns != 3 {
+		t.Fatalf("after the requests got %+v", stats)
+	}
+}
@@ -0,0 +1,86 @@
+package dynhttpsrv
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Sync makes the registered endpoints match desired, reloading the router once, and
+// returns how many endpoints were added and removed. Registered endpoints are kept
+// when desired holds them again, or holds an equivalent one: one with the same
+// non-empty Version, methods, paths and hosts and otherwise the same settings, so
+// endpoints built afresh from a source of truth leave unchanged routes alone. Other
+// endpoints of desired replace the registered ones, since their functions may
+// differ even when they come from the same code. If desired is not valid, the
+// registered endpoints are kept.
+func (dhs *DynHttpSrv) Sync(desired []*Endpoint) (added, removed int, err error) {
+	dhs.mu.Lock()
+	defer dhs.unlock()
+	current := make(map[string][]*Endpoint, len(dhs.endpoints))
+	for _, endpoint := range dhs.endpoints {
+		key := syncKey(endpoint)
+		current[key] = append(current[key], endpoint)
+	}
+	next := make([]*Endpoint, 0, len(desired))
+	var fresh []*Endpoint
+	for _, endpoint := range desired {
+		key := syncKey(endpoint)
+		if candidates := current[key]; len(candidates) > 0 && equivalentEndpoints(candidates[0], endpoint) {
+			next = append(next, candidates[0])
+			current[key] = candidates[1:]
+			continue
+		}
+		next = append(next, endpoint)
+		fresh = append(fresh, endpoint)
+	}
+	revert := assignGroup(fresh, nil)
+	if err := dhs.checkEndpoints(nil, next); err != nil {
+		revert()
+		return 0, 0, err
+	}
+	removed = len(dhs.endpoints) - (len(next) - len(fresh))
+	dhs.endpoints = next
+	touch(fresh)
+	dhs.assignIDs()
+	if err := dhs.reloadEndpoints(); err != nil {
+		revert()
+		return 0, 0, err
+	}
+	return len(fresh), removed, nil
+}
+
+// syncKey identifies an endpoint by its methods, paths and hosts, whatever their order
+func syncKey(endpoint *Endpoint) string {
+	methods := endpointMethods(endpoint)
+	for i, method := range methods {
+		methods[i] = strings.ToUpper(method)
+	}
+	paths := append([]string(nil), endpointPaths(endpoint)...)
+	hosts := append([]string(nil), endpoint.Hosts...)
+	sort.Strings(methods)
+	sort.Strings(paths)
+	sort.Strings(hosts)
+	return strings.Join(methods, ",") + " " + strings.Join(paths, ",") + " " + strings.Join(hosts, ",")
+}
+
+// equivalentEndpoints reports whether a and b, which share a syncKey, are the same
+// endpoint or share a Version and agree on every setting which affects how they
+// serve requests
+func equivalentEndpoints(a, b *Endpoint) bool {
+	if a == b {
+		return true
+	}
+	if a.Version == "" || a.Version != b.Version {
+		return false
+	}
+	if (a.Uploads == nil) != (b.Uploads == nil) || a.Uploads != nil && *a.Uploads != *b.Uploads {
+		return false
+	}
+	if a.group != b.group || a.Name != b.Name || a.Disabled != b.Disabled || a.Priority != b.Priority || a.Timeout != b.Timeout || a.MaxBodySize != b.MaxBodySize ||
+		a.MaxConcurrent != b.MaxConcurrent {
+		return false
+	}
+	return maps.Equal(a.Headers, b.Headers) && maps.Equal(a.Queries, b.Queries) && slices.Equal(a.Schemes, b.Schemes)
+}
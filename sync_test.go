@@ -0,0 +1,82 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSyncReplacesChangedHandler(t *testing.T) {
+	dhs := newServer(t)
+	build := func(body string) []*Endpoint {
+		return []*Endpoint{{Paths: []string{"/v"}, Handler: versioned(body)}}
+	}
+	if added, removed, err := dhs.Sync(build("v1")); added != 1 || removed != 0 || err != nil {
+		t.Fatalf("first Sync = %d, %d, %v", added, removed, err)
+	}
+	// the same closure literal with other captured state
+	if added, removed, err := dhs.Sync(build("v2")); added != 1 || removed != 1 || err != nil {
+		t.Fatalf("Sync with a rebuilt handler = %d, %d, %v", added, removed, err)
+	}
+	expect(t, dhs, "GET", "/v", http.StatusOK, "v2")
+
+	kept := dhs.Endpoints()
+	if added, removed, err := dhs.Sync(kept); added != 0 || removed != 0 || err != nil {
+		t.Fatalf("Sync with the registered endpoints = %d, %d, %v", added, removed, err)
+	}
+}
+
+func TestSyncKeepsUnchangedVersions(t *testing.T) {
+	dhs := newServer(t)
+	build := func(versions map[string]string) []*Endpoint {
+		var endpoints []*Endpoint
+		for _, path := range []string{"/a", "/b", "/c", "/d"} {
+			version, ok := versions[path]
+			if !ok {
+				continue
+			}
+			endpoints = append(endpoints, &Endpoint{Paths: []string{path}, Version: version, Timeout: time.Second, Handler: versioned(path + " " + version)})
+		}
+		return endpoints
+	}
+	setA := build(map[string]string{"/a": "1", "/b": "1", "/c": "1"})
+	dhs.Sync(setA)
+	reloads := 0
+	dhs.OnReload(func([]*Endpoint) { reloads++ })
+
+	setB := build(map[string]string{"/a": "1", "/b": "2", "/d": "1"})
+	added, removed, err := dhs.Sync(setB)
+	if added != 2 || removed != 2 || err != nil {
+		t.Fatalf("Sync = %d, %d, %v", added, removed, err)
+	}
+	if reloads != 1 {
+		t.Fatalf("%d router swaps", reloads)
+	}
+	endpoints := dhs.Endpoints()
+	if endpoints[0] != setA[0] || endpoints[1] != setB[1] || endpoints[2] != setB[2] {
+		t.Fatal("unchanged endpoint replaced or changed ones kept")
+	}
+	expect(t, dhs, "GET", "/a", http.StatusOK, "/a 1")
+	expect(t, dhs, "GET", "/b", http.StatusOK, "/b 2")
+	expect(t, dhs, "GET", "/c", http.StatusNotFound, "")
+	expect(t, dhs, "GET", "/d", http.StatusOK, "/d 1")
+
+	// the same Version with other settings is a change too
+	setC := build(map[string]string{"/a": "1", "/b": "2", "/d": "1"})
+	setC[0].Timeout = 2 * time.Second
+	if added, removed, _ := dhs.Sync(setC); added != 1 || removed != 1 {
+		t.Fatalf("Sync with a changed setting = %d, %d", added, removed)
+	}
+	if reloads != 2 {
+		t.Fatalf("%d router swaps", reloads)
+	}
+}
+
+func TestSyncRejectsInvalidSet(t *testing.T) {
+	dhs := newServer(t)
+	dhs.Sync([]*Endpoint{{Paths: []string{"/a"}, Handler: text("a")}})
+	if _, _, err := dhs.Sync([]*Endpoint{{Paths: []string{"/a/{id"}, Handler: text("bad")}}); err == nil {
+		t.Fatal("Sync accepted an invalid endpoint")
+	}
+	expect(t, dhs, "GET", "/a", http.StatusOK, "a")
+}
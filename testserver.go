@@ -0,0 +1,89 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// NewTestServer creates a dynamic HTTP server obeying cancelling through ctx which
+// serves on an in-memory listener instead of a port, along with a client whose
+// requests reach it whatever their URL's host
+func NewTestServer(ctx context.Context, opts ...Option) (*DynHttpSrv, *http.Client) {
+	ln := newMemListener()
+	dhs := NewWithListener(ctx, ln, opts...)
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return ln.dial(ctx)
+			},
+		},
+	}
+	return dhs, client
+}
+
+// ServeRequest runs req through the server's handler in the calling goroutine and
+// returns the recorded response
+func (dhs *DynHttpSrv) ServeRequest(req *http.Request) *http.Response {
+	req = req.WithContext(context.WithValue(req.Context(), serverKey{}, dhs))
+	rec := httptest.NewRecorder()
+	dhs.server.Handler.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+// memAddr is the address of every memListener
+type memAddr struct{}
+
+func (memAddr) Network() string { return "mem" }
+func (memAddr) String() string  { return "dynhttpsrv-test" }
+
+// memListener accepts the server ends of pipes created by dial
+type memListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMemListener() *memListener {
+	return &memListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr {
+	return memAddr{}
+}
+
+// dial connects a new pipe to the listener, returning the client end
+func (l *memListener) dial(ctx context.Context) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+	case <-ctx.Done():
+		server.Close()
+		client.Close()
+		return nil, ctx.Err()
+	}
+	server.Close()
+	client.Close()
+	return nil, errors.New("test server closed")
+}
@@ -0,0 +1,48 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewTestServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs, client := NewTestServer(ctx, WithLogger(nil))
+	endpoint := &Endpoint{Paths: []string{"/hello"}, Handler: text("in memory")}
+	dhs.AddEndpoint(endpoint)
+	if status, body := get(t, client, "http://any-host/hello"); status != http.StatusOK || body != "in memory" {
+		t.Fatalf("got %d %q", status, body)
+	}
+	dhs.DelEndpoint(endpoint)
+	if status, _ := get(t, client, "http://any-host/hello"); status != http.StatusNotFound {
+		t.Fatalf("deleted endpoint got %d", status)
+	}
+	cancel()
+	waitDone(t, dhs, 5*time.Second)
+	if _, err := client.Get("http://any-host/hello"); err == nil {
+		t.Fatal("connected after shutdown")
+	}
+}
+
+func TestServeRequest(t *testing.T) {
+	dhs := newServer(t, WithRequestID())
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/users/{id}"}, Handler: func(w http.ResponseWriter, r *http.Request) {
+		if serverFrom(r.Context()) != dhs {
+			t.Error("request context does not carry the server")
+		}
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, r.URL.Path)
+	}})
+	resp := dhs.ServeRequest(httptest.NewRequest("PUT", "/users/7", nil))
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusAccepted || string(body) != "/users/7" {
+		t.Fatalf("got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get(RequestIDHeader) == "" {
+		t.Fatal("server-wide wrappers skipped")
+	}
+}
@@ -0,0 +1,88 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+)
+
+// NewTLS creates a new dynamic HTTPS server listening on address with the certificate
+// and key loaded from certFile and keyFile and obeying cancelling through ctx
+func NewTLS(ctx context.Context, addr, certFile, keyFile string, opts ...Option) *DynHttpSrv {
+	return New(ctx, addr, append([]Option{withCertFiles(certFile, keyFile)}, opts...)...)
+}
+
+// WithTLS serves HTTPS using config, which may supply its certificates through
+// Certificates or GetCertificate
+func WithTLS(config *tls.Config) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.server.TLSConfig = config
+	}
+}
+
+// SetCertificate makes new TLS handshakes present cert, for example after it was
+// renewed, while established connections carry on. It has no effect on servers not
+// serving HTTPS.
+func (dhs *DynHttpSrv) SetCertificate(cert tls.Certificate) {
+	dhs.certificate.Store(&cert)
+}
+
+// installGetCertificate makes the TLS config serve the certificate set through
+// SetCertificate if any, and otherwise the ones it was configured with or loaded
+// from the certificate files. Everything goes through GetCertificate because
+// crypto/tls skips it without SNI when the config lists Certificates.
+func (dhs *DynHttpSrv) installGetCertificate() error {
+	if dhs.certFile != "" || dhs.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(dhs.certFile, dhs.keyFile)
+		if err != nil {
+			return err
+		}
+		dhs.certificate.Store(&cert)
+	}
+	var config *tls.Config
+	if dhs.server.TLSConfig != nil {
+		config = dhs.server.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	configured := config.GetCertificate
+	certs := config.Certificates
+	config.Certificates = nil
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert := dhs.certificate.Load(); cert != nil {
+			return cert, nil
+		}
+		if configured != nil {
+			return configured(hello)
+		}
+		for i := range certs {
+			if hello.SupportsCertificate(&certs[i]) == nil {
+				return &certs[i], nil
+			}
+		}
+		if len(certs) > 0 {
+			return &certs[0], nil
+		}
+		return nil, errors.New("no certificate configured")
+	}
+	dhs.server.TLSConfig = config
+	return nil
+}
+
+func withCertFiles(certFile, keyFile string) Option {
+	return func(dhs *DynHttpSrv) {
+		dhs.certFile = certFile
+		dhs.keyFile = keyFile
+	}
+}
+
+// usesTLS reports whether the server was configured to serve HTTPS
+func (dhs *DynHttpSrv) usesTLS() bool {
+	return dhs.servesTLS
+}
+
+// configuredTLS reports whether the options asked for HTTPS. It must be called
+// before serving, which fills in the TLS config for HTTP/2 anyway.
+func (dhs *DynHttpSrv) configuredTLS() bool {
+	return dhs.server.TLSConfig != nil || dhs.certFile != "" || dhs.keyFile != ""
+}
@@ -0,0 +1,131 @@
+package dynhttpsrv
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSignedCert returns a certificate for 127.0.0.1 with common name cn along with
+// its PEM encoded certificate and key
+func selfSignedCert(t testing.TB, cn string) (tls.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certPEM, keyPEM
+}
+
+// tlsClient returns a client trusting only the certificate in certPEM
+func tlsClient(t testing.TB, certPEM []byte) *http.Client {
+	t.Helper()
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(certPEM) {
+		t.Fatal("invalid certificate")
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+}
+
+func TestNewTLS(t *testing.T) {
+	_, certPEM, keyPEM := selfSignedCert(t, "files")
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, certPEM, 0600)
+	os.WriteFile(keyFile, keyPEM, 0600)
+	ctx, cancel := context.WithCancel(context.Background())
+	dhs := NewTLS(ctx, "127.0.0.1:0", certFile, keyFile, WithLogger(nil))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("secure")})
+	<-dhs.Ready()
+	addr, err := dhs.Addr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body := get(t, tlsClient(t, certPEM), "https://"+addr.String()+"/")
+	if status != http.StatusOK || body != "secure" {
+		t.Fatalf("got %d %q", status, body)
+	}
+	cancel()
+	if err := dhs.ServerError(); err != nil {
+		t.Fatalf("clean shutdown reported %v", err)
+	}
+}
+
+func TestWithTLS(t *testing.T) {
+	cert, certPEM, _ := selfSignedCert(t, "memory")
+	var calls int
+	config := &tls.Config{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		calls++
+		return &cert, nil
+	}}
+	dhs, url := startServer(t, WithTLS(config))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("secure")})
+	client := tlsClient(t, certPEM)
+	resp, err := client.Get("https" + url[len("http"):] + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "secure" || resp.TLS == nil || calls != 1 {
+		t.Fatalf("got %q over TLS %v with %d GetCertificate calls", body, resp.TLS != nil, calls)
+	}
+}
+
+func TestSetCertificate(t *testing.T) {
+	first, firstPEM, _ := selfSignedCert(t, "first")
+	second, secondPEM, _ := selfSignedCert(t, "second")
+	dhs, url := startServer(t, WithTLS(&tls.Config{Certificates: []tls.Certificate{first}}))
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/"}, Handler: text("secure")})
+	url = "https" + url[len("http"):] + "/"
+	presented := func(certPEM []byte) string {
+		t.Helper()
+		resp, err := tlsClient(t, certPEM).Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if cn := presented(firstPEM); cn != "first" {
+		t.Fatalf("presented %q", cn)
+	}
+	dhs.SetCertificate(second)
+	if cn := presented(secondPEM); cn != "second" {
+		t.Fatalf("presented %q after SetCertificate", cn)
+	}
+}
@@ -0,0 +1,172 @@
+package dynhttpsrv
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// defaultUploadMemory is how much of a multipart form is kept in memory, the rest
+// going to temporary files, when UploadLimits.MaxMemory is zero
+const defaultUploadMemory = 32 << 20
+
+// errUploadTooLarge reports a multipart form exceeding its UploadLimits
+var errUploadTooLarge = errors.New("upload too large")
+
+// UploadLimits restricts the multipart/form-data requests an endpoint accepts. The
+// form is read part by part before the handler runs, which finds it in
+// r.MultipartForm, and requests get a 413 as soon as a part exceeds a limit,
+// before the parts after it are read. Zero fields impose no limit.
+type UploadLimits struct {
+	// MaxTotalSize caps the whole request body in bytes
+	MaxTotalSize int64
+	// MaxFileSize caps every uploaded file in bytes
+	MaxFileSize int64
+	// MaxFiles caps how many files a request uploads
+	MaxFiles int
+	// MaxMemory is how many bytes of the form are kept in memory, the rest going
+	// to temporary files. Zero means 32MiB.
+	MaxMemory int64
+}
+
+// limitUploads reads the multipart form of requests to next, answering 413 if it
+// exceeds limits and 400 if it is malformed. The temporary files of the form are
+// removed once next returns or the request is rejected.
+func limitUploads(limits UploadLimits, next http.Handler) http.Handler {
+	maxMemory := limits.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = defaultUploadMemory
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "multipart/form-data" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if limits.MaxTotalSize > 0 {
+			if r.ContentLength > limits.MaxTotalSize {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limits.MaxTotalSize)
+		}
+		err := r.ParseForm()
+		var form *multipart.Form
+		if err == nil {
+			form, err = readUploads(limits, maxMemory, r)
+		}
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr), errors.Is(err, errUploadTooLarge), errors.Is(err, multipart.ErrMessageTooLarge):
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		defer form.RemoveAll()
+		// As ParseMultipartForm does, which then finds the form already parsed
+		for key, values := range form.Value {
+			r.Form[key] = append(r.Form[key], values...)
+			r.PostForm[key] = append(r.PostForm[key], values...)
+		}
+		r.MultipartForm = form
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readUploads reads the multipart form of r one part at a time, failing with
+// errUploadTooLarge once a part goes beyond limits. Nothing is left on disk when it
+// fails.
+func readUploads(limits UploadLimits, maxMemory int64, r *http.Request) (*multipart.Form, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	form := &multipart.Form{Value: make(map[string][]string), File: make(map[string][]*multipart.FileHeader)}
+	files := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		maxSize := int64(0)
+		if part.FileName() != "" {
+			files++
+			if limits.MaxFiles > 0 && files > limits.MaxFiles {
+				form.RemoveAll()
+				return nil, errUploadTooLarge
+			}
+			maxSize = limits.MaxFileSize
+		}
+		partForm, err := readPart(part, maxSize, max(maxMemory, 0))
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		for key, values := range partForm.Value {
+			form.Value[key] = append(form.Value[key], values...)
+			for _, value := range values {
+				maxMemory -= int64(len(value))
+			}
+		}
+		for key, headers := range partForm.File {
+			form.File[key] = append(form.File[key], headers...)
+			for _, header := range headers {
+				maxMemory -= header.Size
+			}
+		}
+	}
+}
+
+// readPart reads part into a form of its own, keeping up to maxMemory bytes of it
+// in memory, and fails with errUploadTooLarge once more than maxSize bytes of it
+// were read unless maxSize is zero. Parts are re-encoded as a form of their own for
+// multipart.Reader.ReadForm, the only way to get file headers which can be opened.
+func readPart(part *multipart.Part, maxSize, maxMemory int64) (*multipart.Form, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		dst, err := mw.CreatePart(part.Header)
+		if err == nil {
+			var src io.Reader = part
+			if maxSize > 0 {
+				src = &sizeLimitedReader{r: part, n: maxSize}
+			}
+			_, err = io.Copy(dst, src)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	form, err := multipart.NewReader(pr, mw.Boundary()).ReadForm(maxMemory)
+	// Unblocks the copy if ReadForm gave up early, which must be done with part
+	// before the next one is read
+	pr.Close()
+	<-copied
+	return form, err
+}
+
+// sizeLimitedReader fails with errUploadTooLarge once more than n bytes were read
+type sizeLimitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,135 @@
+package dynhttpsrv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// uploadFile is a file part of a multipart form, sent as size repetitions of "x"
+type uploadFile struct {
+	name string
+	size int
+}
+
+// uploadRequest builds a POST to target streaming a form with field "title" and
+// files. Unless complete is set the body then stalls instead of ending, until the
+// test does, so the request fails if the server reads past the files.
+func uploadRequest(t *testing.T, target string, complete bool, files ...uploadFile) *http.Request {
+	pr, pw := io.Pipe()
+	stall := make(chan struct{})
+	t.Cleanup(func() {
+		close(stall)
+		pr.Close()
+	})
+	mw := multipart.NewWriter(pw)
+	go func() {
+		mw.WriteField("title", "holiday")
+		for _, file := range files {
+			part, err := mw.CreateFormFile("file", file.name)
+			if err != nil {
+				return
+			}
+			if _, err := part.Write(bytes.Repeat([]byte("x"), file.size)); err != nil {
+				return
+			}
+		}
+		if complete {
+			pw.CloseWithError(mw.Close())
+			return
+		}
+		// the delimiter ending the last file, and the header of a part whose
+		// content never comes
+		mw.CreateFormField("more")
+		<-stall
+	}()
+	req := httptest.NewRequest("POST", target, pr)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// listUploads reports the form the handler finds, opening every file
+func listUploads(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "%s %s", r.FormValue("title"), r.FormValue("album"))
+	if r.MultipartForm == nil {
+		return
+	}
+	for _, header := range r.MultipartForm.File["file"] {
+		f, err := header.Open()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		content, _ := io.ReadAll(f)
+		f.Close()
+		fmt.Fprintf(w, " %s:%d", header.Filename, len(content))
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	dhs := newServer(t)
+	var ran bool
+	limits := &UploadLimits{MaxTotalSize: 1 << 20, MaxFileSize: 100, MaxFiles: 2, MaxMemory: 1}
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/photos"}, Uploads: limits, Handler: func(w http.ResponseWriter, r *http.Request) {
+		ran = true
+		listUploads(w, r)
+	}})
+
+	resp := dhs.ServeRequest(uploadRequest(t, "/photos?album=summer", true, uploadFile{"a.jpg", 100}, uploadFile{"b.jpg", 10}))
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "holiday summer a.jpg:100 b.jpg:10" {
+		t.Fatalf("upload within the limits got %d %q", resp.StatusCode, body)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		files []uploadFile
+	}{
+		{"oversize file", []uploadFile{{"a.jpg", 10}, {"big.jpg", 101}}},
+		{"too many files", []uploadFile{{"a.jpg", 10}, {"b.jpg", 10}, {"c.jpg", 10}}},
+	} {
+		ran = false
+		// the body stalls after the files, so the request is rejected without
+		// reading on
+		resp := dhs.ServeRequest(uploadRequest(t, "/photos", false, tc.files...))
+		if resp.StatusCode != http.StatusRequestEntityTooLarge || ran {
+			t.Fatalf("%s: got %d, handler ran %v", tc.name, resp.StatusCode, ran)
+		}
+	}
+
+	if leftovers, _ := os.ReadDir(tmp); len(leftovers) != 0 {
+		t.Fatalf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestUploadTotalSize(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/photos"}, Uploads: &UploadLimits{MaxTotalSize: 1000}, Handler: listUploads})
+	// a streamed body has no Content-Length to reject it by upfront
+	resp := dhs.ServeRequest(uploadRequest(t, "/photos", false, uploadFile{"a.jpg", 600}, uploadFile{"b.jpg", 600}))
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload over the total size got %d", resp.StatusCode)
+	}
+}
+
+func TestMalformedUpload(t *testing.T) {
+	dhs := newServer(t)
+	dhs.AddEndpoint(&Endpoint{Paths: []string{"/photos"}, Uploads: &UploadLimits{}, Handler: listUploads})
+	req := httptest.NewRequest("POST", "/photos", strings.NewReader("--b\r\nno headers end"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=b")
+	if resp := dhs.ServeRequest(req); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("malformed upload got %d", resp.StatusCode)
+	}
+	req = httptest.NewRequest("POST", "/photos", strings.NewReader("plain"))
+	if resp := dhs.ServeRequest(req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("request which is no upload got %d", resp.StatusCode)
+	}
+}
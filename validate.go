@@ -0,0 +1,67 @@
+package dynhttpsrv
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrInvalidEndpoint is wrapped by the errors AddEndpoint returns for endpoints whose
+// handlers are missing or ambiguous, or whose methods or route templates are
+// malformed
+var ErrInvalidEndpoint = errors.New("invalid endpoint")
+
+var knownMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// validateEndpoint checks that endpoint sets exactly one of Handler and HandlerObj,
+// or Handlers, that every method of endpoint is a known HTTP method and that every template
+// compiles, by trying each on a throwaway route
+func validateEndpoint(endpoint *Endpoint) error {
+	if endpoint.Handler != nil && endpoint.HandlerObj != nil {
+		return fmt.Errorf("%w: both Handler and HandlerObj set", ErrInvalidEndpoint)
+	}
+	if endpoint.Handler == nil && endpoint.HandlerObj == nil && len(endpoint.Handlers) == 0 {
+		return fmt.Errorf("%w: no Handler, HandlerObj or Handlers set", ErrInvalidEndpoint)
+	}
+	for method, handler := range endpoint.Handlers {
+		if handler == nil {
+			return fmt.Errorf("%w: nil handler for method %q", ErrInvalidEndpoint, method)
+		}
+	}
+	for _, method := range endpointMethods(endpoint) {
+		if !containsFold(knownMethods, method) {
+			return fmt.Errorf("%w: unknown method %q", ErrInvalidEndpoint, method)
+		}
+	}
+	for _, path := range endpoint.Paths {
+		path = endpointPrefix(endpoint) + path
+		if err := trialRoute().Path(path).GetError(); err != nil {
+			return fmt.Errorf("%w: path %q: %v", ErrInvalidEndpoint, path, err)
+		}
+	}
+	for _, host := range endpoint.Hosts {
+		if err := trialRoute().Host(host).GetError(); err != nil {
+			return fmt.Errorf("%w: host %q: %v", ErrInvalidEndpoint, host, err)
+		}
+	}
+	if len(endpoint.Headers) > 0 {
+		if err := trialRoute().Headers(matcherPairs(endpoint.Headers)...).GetError(); err != nil {
+			return fmt.Errorf("%w: headers: %v", ErrInvalidEndpoint, err)
+		}
+	}
+	if len(endpoint.Queries) > 0 {
+		if err := trialRoute().Queries(matcherPairs(endpoint.Queries)...).GetError(); err != nil {
+			return fmt.Errorf("%w: queries: %v", ErrInvalidEndpoint, err)
+		}
+	}
+	return nil
+}
+
+func trialRoute() *mux.Route {
+	return mux.NewRouter().NewRoute()
+}
@@ -0,0 +1,39 @@
+package dynhttpsrv
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAddEndpointValidates(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint *Endpoint
+		mention  string
+	}{
+		{"invalid regexp", &Endpoint{Paths: []string{"/items/{id:[0-9+}"}, Handler: text("")}, "/items/{id:[0-9+}"},
+		{"unbalanced braces", &Endpoint{Paths: []string{"/items/{id"}, Handler: text("")}, "/items/{id"},
+		{"bogus method", &Endpoint{Methods: []string{"FETCH"}, Paths: []string{"/"}, Handler: text("")}, "FETCH"},
+		{"bad host", &Endpoint{Hosts: []string{"{sub:[}.example.com"}, Paths: []string{"/"}, Handler: text("")}, "host"},
+		{"two handlers", &Endpoint{Paths: []string{"/"}, Handler: text(""), HandlerObj: http.HandlerFunc(text(""))}, "HandlerObj"},
+		{"no handler", &Endpoint{Paths: []string{"/"}}, "no Handler"},
+		{"nil method handler", &Endpoint{Paths: []string{"/"}, Handlers: map[string]http.HandlerFunc{"GET": nil}}, "GET"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dhs := newServer(t)
+			err := dhs.AddEndpoint(test.endpoint)
+			if !errors.Is(err, ErrInvalidEndpoint) {
+				t.Fatalf("AddEndpoint() = %v, want ErrInvalidEndpoint", err)
+			}
+			if !strings.Contains(err.Error(), test.mention) {
+				t.Fatalf("error %q does not name %q", err, test.mention)
+			}
+			if len(dhs.Endpoints()) != 0 {
+				t.Fatal("invalid endpoint was registered")
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// wellKnownMaxAge is how long clients may cache the favicon and robots.txt
+const wellKnownMaxAge = 24 * 60 * 60
+
+// AddFavicon registers and returns an endpoint serving data as /favicon.ico, or
+// answering 204 if data is empty so browsers asking for it do not get 404s
+func (dhs *DynHttpSrv) AddFavicon(data []byte) (*Endpoint, error) {
+	contentType := http.DetectContentType(data)
+	if contentType == "application/octet-stream" {
+		contentType = "image/x-icon"
+	}
+	return dhs.addCachedFile("/favicon.ico", contentType, data)
+}
+
+// AddRobots registers and returns an endpoint serving content as /robots.txt, or
+// answering 204 if content is empty
+func (dhs *DynHttpSrv) AddRobots(content string) (*Endpoint, error) {
+	return dhs.addCachedFile("/robots.txt", "text/plain; charset=utf-8", []byte(content))
+}
+
+// addCachedFile registers an endpoint serving data at path with contentType and
+// headers letting clients cache it
+func (dhs *DynHttpSrv) addCachedFile(path, contentType string, data []byte) (*Endpoint, error) {
+	cacheControl := "public, max-age=" + strconv.Itoa(wellKnownMaxAge)
+	endpoint := &Endpoint{
+		Methods: []string{http.MethodGet, http.MethodHead},
+		Paths:   []string{path},
+		Handler: func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Cache-Control", cacheControl)
+			if len(data) == 0 {
+				res.WriteHeader(http.StatusNoContent)
+				return
+			}
+			res.Header().Set("Content-Type", contentType)
+			res.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			res.Write(data)
+		},
+	}
+	if err := dhs.AddEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
@@ -0,0 +1,41 @@
+package dynhttpsrv
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFaviconAndRobots(t *testing.T) {
+	dhs := newServer(t)
+	favicon, err := dhs.AddFavicon([]byte{0, 0, 1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dhs.AddRobots("User-agent: *\nDisallow: /\n"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		target, contentType, body string
+	}{
+		{"/favicon.ico", "image/x-icon", "\x00\x00\x01\x00"},
+		{"/robots.txt", "text/plain; charset=utf-8", "User-agent: *\nDisallow: /\n"},
+	}
+	for _, test := range tests {
+		resp, body := do(t, dhs, "GET", test.target)
+		if resp.StatusCode != http.StatusOK || body != test.body {
+			t.Errorf("%s: got %d %q", test.target, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: Content-Type %q", test.target, got)
+		}
+		if resp.Header.Get("Cache-Control") == "" {
+			t.Errorf("%s: no Cache-Control", test.target)
+		}
+	}
+
+	dhs.DelEndpoint(favicon)
+	if _, err := dhs.AddFavicon(nil); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, dhs, "GET", "/favicon.ico", http.StatusNoContent, "")
+}